@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maintenance mode: the plugin routes return 503, /readyz too,
+// so the load balancers drain the instance without killing it
+var maintenance atomic.Bool
+
+// Retry-After of the 503 answers in maintenance mode
+var retryAfter = 30 * time.Second
+
+// Available wraps a plugin route to answer 503 in maintenance mode,
+// during the shutdown or while draining
+func Available(next http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if maintenance.Load() {
+			writeError(response, http.StatusServiceUnavailable, CodeMaintenance, "the runner is in maintenance mode")
+			return
+		}
+		if shuttingDown.Load() {
+			writeError(response, http.StatusServiceUnavailable, CodeShuttingDown, "the runner is shutting down")
+			return
+		}
+		if draining.Load() {
+			writeError(response, http.StatusServiceUnavailable, CodeDraining, "the runner is draining")
+			return
+		}
+		pluginRequests.Add(1)
+		defer pluginRequests.Add(-1)
+		next(response, request)
+	}
+}
+
+// Admin wraps an admin route to require the "Authorization: Bearer <secret>" header
+func Admin(secret string, next http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			textError(response, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(response, request)
+	}
+}
+
+// MaintenanceHandler turns the maintenance mode on or off (POST /admin/maintenance, body: on|off)
+func MaintenanceHandler(response http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(request.Body, 16))
+	if err != nil {
+		textError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch strings.TrimSpace(string(body)) {
+	case "on":
+		maintenance.Store(true)
+		log.Println("🚧 maintenance mode on")
+	case "off":
+		maintenance.Store(false)
+		log.Println("🟢 maintenance mode off")
+	default:
+		textError(response, http.StatusBadRequest, "expected on or off")
+		return
+	}
+	writeStatus(response, http.StatusOK)
+}
+
+// one reload at a time: the last built plugin is the stored one
+var reloading sync.Mutex
+
+// ReloadHandler builds a standby plugin (wasm file or manifest: compilation,
+// -init-function and warmup) while the current one keeps serving, then
+// swaps it (POST /admin/reload): the new calls go to the new plugin, the
+// in-flight ones end on the old one. A failed build keeps the current plugin.
+// A ReloadSource body swaps the main module to another one, which the next
+// reloads keep.
+func ReloadHandler(response http.ResponseWriter, request *http.Request) {
+	reloading.Lock()
+	defer reloading.Unlock()
+	source := currentSource()
+	var reload ReloadSource
+	body, err := io.ReadAll(http.MaxBytesReader(response, request.Body, maxReloadBodyBytes))
+	if err == nil && len(bytes.TrimSpace(body)) > 0 {
+		if err = json.Unmarshal(body, &reload); err == nil {
+			source.Module, err = reload.Module()
+		}
+	}
+	if errors.Is(err, ErrSourceNotAllowed) {
+		writeError(response, http.StatusForbidden, CodeSourceNotAllowed, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(response, http.StatusBadRequest, CodeInvalidRequest, "invalid reload source: "+err.Error())
+		return
+	}
+	start := time.Now()
+	// the plugin outlives the request
+	pluginInst, err := LoadPlugin(context.Background(), source)
+	if err == nil {
+		if err = CheckPipeline(pluginInst); err == nil {
+			err = Warmup(context.Background(), pluginInst, WarmupFunctions(pluginInst))
+		}
+		if err != nil {
+			pluginInst.close(context.Background())
+		}
+	}
+	if err != nil {
+		log.Println("🔴 !!! Error when reloading the plugin, still serving the current one:", err)
+		serving := ""
+		if current, err := acquire(); err == nil {
+			serving = current.module.SHA256
+			current.release()
+		}
+		NotifyReloadFailed("code", serving, err)
+		writeError(response, http.StatusInternalServerError, CodeReloadFailed, err.Error())
+		return
+	}
+	StorePlugin(pluginInst)
+	setSource(source)
+	// give the new plugin a chance
+	breaker.Reset()
+	resetHealth()
+	resetSmoke()
+	SmokeCheck()
+	log.Println("🔄 plugin reloaded:", source, "in", time.Since(start).Round(time.Millisecond))
+	NotifyReload(pluginInst)
+	writeStatus(response, http.StatusOK)
+}
+
+// EchoResponse is the input a call would receive (POST /admin/echo)
+type EchoResponse struct {
+	Route    string `json:"route"`
+	Function string `json:"function"`
+	// Content-Type of the request, or detected from the input
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+	// base64 encoded input
+	Input string `json:"input"`
+	// the plugin pulls the input with read_chunk (-stream-body)
+	Streamed bool `json:"streamed"`
+}
+
+// EchoHandler prepares the input of a call like POST / (or POST /invoke with
+// ?route=/invoke) and returns it without calling the plugin (POST /admin/echo)
+func EchoHandler(defaultFunction string, prepareInput func(http.ResponseWriter, *http.Request) ([]byte, error), streamed bool) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		echo := EchoResponse{Route: "/", Function: defaultFunction, Streamed: streamed}
+		contentType := request.Header.Get("Content-Type")
+		var input []byte
+		var err error
+		if request.URL.Query().Get("route") == "/invoke" {
+			echo.Route, echo.Streamed, contentType = "/invoke", false, ""
+			echo.Function, _, input, err = decodeInvoke(response, request)
+			input = DefaultInput(echo.Function, input)
+		} else {
+			input, err = prepareInput(response, request)
+		}
+		if err != nil {
+			status, code := callStatus(err)
+			writeError(response, status, code, err.Error())
+			return
+		}
+		if contentType == "" {
+			contentType = http.DetectContentType(input)
+		}
+		echo.ContentType = contentType
+		echo.Size = len(input)
+		echo.Input = base64.StdEncoding.EncodeToString(input)
+		response.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(response).Encode(echo)
+	}
+}
+
+// HealthHandler answers 200 while the process is alive (GET /health)
+func HealthHandler(response http.ResponseWriter, request *http.Request) {
+	writeStatus(response, http.StatusOK)
+}
+
+// ReadyHandler answers 503 in maintenance mode, during the shutdown,
+// while draining, without plugin or when the health function of the
+// plugin fails (GET /readyz)
+func ReadyHandler(response http.ResponseWriter, request *http.Request) {
+	_, err := GetPlugin()
+	if err != nil || maintenance.Load() || shuttingDown.Load() || draining.Load() {
+		writeStatus(response, http.StatusServiceUnavailable)
+		return
+	}
+	// the plugin declares its own readiness (-health-function)
+	if err := PluginHealth(); err != nil {
+		writeStatus(response, http.StatusServiceUnavailable)
+		return
+	}
+	// a real call with a realistic input (-smoke-input)
+	if err := SmokeCheck(); err != nil {
+		writeStatus(response, http.StatusServiceUnavailable)
+		return
+	}
+	writeStatus(response, http.StatusOK)
+}
+
+func writeStatus(response http.ResponseWriter, status int) {
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	json.NewEncoder(response).Encode(map[string]any{
+		"status":      http.StatusText(status),
+		"maintenance": maintenance.Load(),
+	})
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// HandlePprof serves the Go profiles on /debug/pprof/ behind the admin
+// secret (-admin-addr only: they never go on the public listener); no
+// cmdline, the arguments hold the secrets
+func HandlePprof(mux *http.ServeMux, secret string) {
+	mux.HandleFunc("GET /debug/pprof/", Admin(secret, pprof.Index))
+	mux.HandleFunc("GET /debug/pprof/profile", Admin(secret, pprof.Profile))
+	mux.HandleFunc("GET /debug/pprof/symbol", Admin(secret, pprof.Symbol))
+	mux.HandleFunc("GET /debug/pprof/trace", Admin(secret, pprof.Trace))
+}
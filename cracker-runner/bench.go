@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BenchResult is the report of a load test of a plugin function
+type BenchResult struct {
+	Calls    int
+	Errors   int
+	Duration time.Duration
+	// latencies of the calls, sorted
+	Latencies []time.Duration
+}
+
+// Percentile returns the latency under which p% of the calls ended
+func (r BenchResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	index := int(float64(len(r.Latencies)-1) * p / 100)
+	return r.Latencies[index]
+}
+
+func (r BenchResult) String() string {
+	var report strings.Builder
+	fmt.Fprintf(&report, "calls:      %d in %s\n", r.Calls, r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&report, "throughput: %.1f calls/s\n", float64(r.Calls)/r.Duration.Seconds())
+	errorRate := 0.0
+	if r.Calls > 0 {
+		errorRate = float64(r.Errors) / float64(r.Calls) * 100
+	}
+	fmt.Fprintf(&report, "errors:     %d (%.2f%%)\n", r.Errors, errorRate)
+	fmt.Fprintf(&report, "latency:    p50 %s, p95 %s, p99 %s\n", r.Percentile(50), r.Percentile(95), r.Percentile(99))
+	return report.String()
+}
+
+// Bench calls the function with the input from concurrency goroutines
+// during the duration, with the plugin of the server (StorePlugin)
+func Bench(ctx context.Context, function string, input []byte, concurrency int, duration time.Duration) BenchResult {
+	var mutex sync.Mutex
+	result := BenchResult{}
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(duration)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var latencies []time.Duration
+			errors := 0
+			for time.Now().Before(deadline) {
+				callCtx, cancel, _ := WithCallTimeout(ctx, callTimeout)
+				callStart := time.Now()
+				_, err := CallPlugin(callCtx, function, input)
+				cancel()
+				latencies = append(latencies, time.Since(callStart))
+				if err != nil {
+					errors++
+				}
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			result.Latencies = append(result.Latencies, latencies...)
+			result.Errors += errors
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+	result.Calls = len(result.Latencies)
+	slices.Sort(result.Latencies)
+	return result
+}
+
+// bench runs the bench subcommand:
+// cracker-runner bench -wasm plugin.wasm -fn say_hello -input @payload.json -concurrency 16 -duration 30s
+func bench(arguments []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	wasmFilePath := flags.String("wasm", "", "wasm file of the plugin")
+	manifestPath := flags.String("manifest", "", "Extism manifest (JSON) of the plugin, instead of -wasm")
+	var allowedHosts ListFlag
+	flags.Var(&allowedHosts, "allowed-host", "host the plugin can reach, repeatable (default: *)")
+	pluginConfig := ConfigFlag{}
+	flags.Var(pluginConfig, "plugin-config", "key=value config of the plugin, repeatable")
+	manifestTimeoutMs := flags.Int64("manifest-timeout-ms", 0, "timeout of the calls enforced by Extism (milliseconds)")
+	function := flags.String("fn", "", "function to call")
+	inputFlag := flags.String("input", "", "input of the calls, @file to read it from a file")
+	concurrency := flags.Int("concurrency", 1, "number of concurrent callers")
+	duration := flags.Duration("duration", 10*time.Second, "duration of the load test")
+	flags.BoolVar(&freshInstance, "fresh-instance", false, "call each request on a new instance of the compiled plugin")
+	flags.IntVar(&poolMin, "pool-min", 0, "warm instances of the compiled plugin created at startup (with -pool-max)")
+	flags.IntVar(&poolMax, "pool-max", 0, "maximum instances of the compiled plugin, created under load (0 = a single shared instance)")
+	flags.DurationVar(&callTimeout, "call-timeout", 0, "deadline of the plugin calls, eg: 5s (0 = none)")
+	flags.Parse(arguments)
+
+	if *function == "" || (*wasmFilePath == "") == (*manifestPath == "") {
+		log.Fatalln("😡: usage: cracker-runner bench (-wasm plugin.wasm | -manifest manifest.json) -fn function [-input @file] [-concurrency 16] [-duration 30s]")
+	}
+	if err := CheckPool(); err != nil {
+		log.Fatalln("😡:", err)
+	}
+	input := []byte(*inputFlag)
+	if path, ok := strings.CutPrefix(*inputFlag, "@"); ok {
+		var err error
+		if input, err = os.ReadFile(path); err != nil {
+			log.Fatalln("😡:", err)
+		}
+	}
+
+	ctx := context.Background()
+	source := PluginSource{
+		ManifestPath: *manifestPath,
+		WasmFilePath: *wasmFilePath,
+		AllowedHosts: allowedHosts,
+		Config:       pluginConfig,
+		Timeout:      time.Duration(*manifestTimeoutMs) * time.Millisecond,
+	}
+	pluginSource = source
+	pluginInst, err := LoadPlugin(ctx, source)
+	if err != nil {
+		log.Fatalln("🔴 !!! Error when loading the plugin", err)
+	}
+	StorePlugin(pluginInst)
+
+	log.Printf("🏋️ bench %s: %d callers for %s", *function, *concurrency, *duration)
+	result := Bench(ctx, *function, input, *concurrency, *duration)
+	fmt.Print(result)
+	fmt.Printf("memory:     %d pages (64 KiB)\n", pluginInst.memory.Pages())
+}
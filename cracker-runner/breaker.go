@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("🔴 circuit open")
+
+// states of the circuit breaker
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Breaker fails the calls fast after consecutive plugin failures: it opens
+// for the cool-down, then lets a single probe call through (half-open)
+// which closes it again on success
+type Breaker struct {
+	mutex sync.Mutex
+	// consecutive failures opening the breaker (0 = disabled)
+	Threshold int
+	Cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	trips     int64
+	// the probe call of the half-open breaker is running
+	probing bool
+}
+
+// BreakerStats is the state of the circuit breaker in /stats
+type BreakerStats struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	// times the breaker opened
+	Trips int64 `json:"trips"`
+}
+
+var breaker = &Breaker{Cooldown: 30 * time.Second, state: BreakerClosed}
+
+// Allow returns ErrCircuitOpen when the call must fail fast
+func (b *Breaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return ErrCircuitOpen
+		}
+		log.Println("🟡 circuit half-open, probing the plugin")
+		b.state = BreakerHalfOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+	default:
+		return nil
+	}
+	b.probing = true
+	return nil
+}
+
+// Success records a successful call of the plugin
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BreakerHalfOpen {
+		log.Println("🟢 circuit closed")
+	}
+	b.state, b.failures, b.probing = BreakerClosed, 0, false
+}
+
+// Failure records a failed call of the plugin
+func (b *Breaker) Failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	if b.Threshold <= 0 {
+		return
+	}
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold && b.state == BreakerClosed {
+		log.Println("🔴 circuit open after", b.failures, "consecutive failures, cool-down:", b.Cooldown)
+		b.state, b.openedAt, b.probing = BreakerOpen, time.Now(), false
+		b.trips++
+	}
+}
+
+// Skip releases the probe of a call which didn't reach the plugin
+// (unknown function, input too large...)
+func (b *Breaker) Skip() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+}
+
+// Reset closes the breaker (eg: after a reload of the plugin)
+func (b *Breaker) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.state, b.failures, b.probing = BreakerClosed, 0, false
+}
+
+func (b *Breaker) Stats() BreakerStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state := b.state
+	// the next call will probe
+	if state == BreakerOpen && time.Since(b.openedAt) >= b.Cooldown {
+		state = BreakerHalfOpen
+	}
+	return BreakerStats{State: state, ConsecutiveFailures: b.failures, Trips: b.trips}
+}
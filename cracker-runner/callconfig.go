@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// config keys a client can override for a call with the X-Plugin-Config
+// header (-call-config-key), none by default
+var callConfigKeys ListFlag
+
+type callConfigKey struct{}
+
+// CallConfig returns the per-call config of the X-Plugin-Config headers
+// (one key=value per header), the keys must be overridable
+func CallConfig(request *http.Request) (map[string]string, error) {
+	values := request.Header.Values("X-Plugin-Config")
+	if len(values) == 0 {
+		return nil, nil
+	}
+	config := map[string]string{}
+	for _, value := range values {
+		key, v, ok := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid X-Plugin-Config header: expected key=value, got %q", value)
+		}
+		if !slices.Contains(callConfigKeys, key) {
+			return nil, fmt.Errorf("invalid X-Plugin-Config header: %s can't be overridden (-call-config-key)", key)
+		}
+		config[key] = v
+	}
+	return config, nil
+}
+
+// WithCallConfig returns a context carrying the per-call config
+func WithCallConfig(ctx context.Context, config map[string]string) context.Context {
+	if len(config) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, callConfigKey{}, config)
+}
+
+// ConfigValue looks a config key up: the per-call config of the context
+// first, then the config of the plugin (manifest, -plugin-config)
+func ConfigValue(ctx context.Context, key string) (string, bool) {
+	if config, ok := ctx.Value(callConfigKey{}).(map[string]string); ok {
+		if value, ok := config[key]; ok {
+			return value, true
+		}
+	}
+	if plugin, ok := ctx.Value(extism.PluginCtxKey("plugin")).(*extism.Plugin); ok {
+		value, ok := plugin.Config[key]
+		return value, ok
+	}
+	return "", false
+}
+
+// ConfigGet is the config_get(key: i64) -> i64 host function (extism:host/user):
+// it returns the offset of the value of the key, the per-call value over the
+// config of the plugin, or 0 when the key is not set
+var ConfigGet = extism.NewHostFunctionWithStack(
+	"config_get",
+	func(ctx context.Context, plugin *extism.CurrentPlugin, stack []uint64) {
+		key, err := plugin.ReadString(stack[0])
+		if err != nil {
+			stack[0] = 0
+			return
+		}
+		value, ok := ConfigValue(ctx, key)
+		if !ok {
+			stack[0] = 0
+			return
+		}
+		offset, err := plugin.WriteString(value)
+		if err != nil {
+			stack[0] = 0
+			return
+		}
+		stack[0] = offset
+	},
+	[]extism.ValueType{extism.ValueTypePTR},
+	[]extism.ValueType{extism.ValueTypePTR},
+)
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// validate the flags and the plugin, then exit without serving (-check-config)
+var checkConfig bool
+
+// ConfigErrors are the problems of the config found at startup, reported
+// together instead of one run at a time
+type ConfigErrors []error
+
+// Add records a problem, a nil error is ignored and a joined one is
+// recorded error by error
+func (c *ConfigErrors) Add(err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		*c = append(*c, joined.Unwrap()...)
+	} else if err != nil {
+		*c = append(*c, err)
+	}
+}
+
+// Exit logs the problems and exits with 1, when there's any
+func (c ConfigErrors) Exit() {
+	if len(c) == 0 {
+		return
+	}
+	log.Printf("🔴 !!! %d config errors:", len(c))
+	for _, err := range c {
+		log.Println("   -", err)
+	}
+	os.Exit(1)
+}
+
+// CheckPort validates the port argument of the http server
+func CheckPort(port string) error {
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return fmt.Errorf("invalid port %q: expected 1-65535", port)
+	}
+	return nil
+}
+
+// CheckAddr validates the host:port of a listener flag, which can't use
+// the port of the http server
+func CheckAddr(name string, addr string, httpPort string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %v", name, addr, err)
+	}
+	if err := CheckPort(port); err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	if port == httpPort {
+		return fmt.Errorf("%s %s uses the port of the http server", name, addr)
+	}
+	return nil
+}
+
+// CheckAllowedHosts validates the glob patterns of the allowed hosts (Extism
+// compiles them on the first request, a bad one would fail the calls)
+func CheckAllowedHosts(hosts []string) error {
+	var errs []error
+	for _, host := range hosts {
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			errs = append(errs, fmt.Errorf("invalid allowed host %q: expected a host name or a pattern, eg: *.example.com", host))
+			continue
+		}
+		if _, err := glob.Compile(host); err != nil {
+			errs = append(errs, fmt.Errorf("invalid allowed host %q: %v", host, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckSource validates the wasm file or the manifest file of the plugin
+func CheckSource(source PluginSource) error {
+	path, name := source.WasmFilePath, "wasm file"
+	if source.ManifestPath != "" {
+		path, name = source.ManifestPath, "manifest"
+	}
+	if path == "" {
+		return errors.New("missing the wasm file argument (or -manifest)")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unreadable %s: %v", name, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+)
+
+// add the X-Content-SHA256 header to the answers (-checksum)
+var checksum bool
+
+// SetChecksum sets the X-Content-SHA256 header (hex) of the plugin output
+func SetChecksum(response http.ResponseWriter, out []byte) {
+	if !checksum {
+		return
+	}
+	sum := sha256.Sum256(out)
+	response.Header().Set("X-Content-SHA256", hex.EncodeToString(sum[:]))
+}
+
+// SetOutputHeaders sets the Content-Length of the plugin output, and its
+// Content-Type detected from the bytes (application/octet-stream for an
+// unknown binary output) unless it's already set, or a -response-header
+// sets it (added later, by headersWriter.WriteHeader)
+func SetOutputHeaders(response http.ResponseWriter, out []byte) {
+	if len(out) == 0 {
+		return
+	}
+	response.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	if response.Header().Get("Content-Type") == "" && http.Header(responseHeaders).Get("Content-Type") == "" {
+		response.Header().Set("Content-Type", http.DetectContentType(out))
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// identical in-flight idempotent calls share a single plugin call (-coalesce)
+var coalesce bool
+
+// functions whose calls are idempotent, coalesced whatever their method (-idempotent-function)
+var idempotentFunctions ListFlag
+
+// flight is a plugin call shared by the identical calls
+type flight struct {
+	done chan struct{}
+	// request id of the call running the plugin
+	requestID string
+	out       []byte
+	err       error
+}
+
+var (
+	flightsMutex sync.Mutex
+	flights      = map[string]*flight{}
+)
+
+// idempotent tells if a call can share the result of an identical one:
+// a GET (-method-header) or a call of an -idempotent-function
+func idempotent(ctx context.Context, functionName string) bool {
+	return Method(ctx) == http.MethodGet || slices.Contains(idempotentFunctions, functionName)
+}
+
+// flightKey identifies the identical calls: function, method, per-call
+// config and input hash
+func flightKey(ctx context.Context, functionName string, input []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(functionName + "\x00" + Method(ctx) + "\x00"))
+	if config, ok := ctx.Value(callConfigKey{}).(map[string]string); ok {
+		for _, key := range slices.Sorted(maps.Keys(config)) {
+			hash.Write([]byte(key + "=" + config[key] + "\x00"))
+		}
+	}
+	hash.Write(input)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// coalesceCall runs the call, or waits for the result of the identical
+// call in flight; a waiter whose deadline is not over calls the plugin
+// itself when the shared call timed out
+func coalesceCall(ctx context.Context, functionName string, input []byte) ([]byte, error) {
+	key := flightKey(ctx, functionName, input)
+
+	flightsMutex.Lock()
+	if shared, ok := flights[key]; ok {
+		flightsMutex.Unlock()
+		select {
+		case <-shared.done:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: waiting for the coalesced call: %v", ErrCallTimeout, ctx.Err())
+		}
+		if errors.Is(shared.err, ErrCallTimeout) && ctx.Err() == nil {
+			return callPlugin(ctx, functionName, input, nil)
+		}
+		log.Printf("🔗 [%s] %s coalesced with [%s]", RequestID(ctx), functionName, shared.requestID)
+		stats.Coalesced(functionName)
+		return shared.out, shared.err
+	}
+	current := &flight{done: make(chan struct{}), requestID: RequestID(ctx)}
+	flights[key] = current
+	flightsMutex.Unlock()
+
+	current.out, current.err = callPlugin(ctx, functionName, input, nil)
+
+	flightsMutex.Lock()
+	delete(flights, key)
+	flightsMutex.Unlock()
+	close(current.done)
+	return current.out, current.err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// per-function caps of the concurrent calls (-max-concurrent fn=n), the
+// other functions are not capped
+var maxConcurrent = FunctionFlag{}
+
+var ErrTooManyCalls = errors.New("too many concurrent calls")
+
+// in-flight calls by function (waiting for the instance or running), protected by inFlightMutex
+var inFlight = map[string]int64{}
+var inFlightMutex sync.Mutex
+
+// enterCall counts a call of the function, or returns ErrTooManyCalls
+// when the function is at its cap; the call must leave
+func enterCall(function string) error {
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+	if limit, ok := maxConcurrent[function]; ok && inFlight[function] >= limit {
+		return fmt.Errorf("%w: %s is limited to %d concurrent calls", ErrTooManyCalls, function, limit)
+	}
+	inFlight[function]++
+	return nil
+}
+
+func leaveCall(function string) {
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+	if inFlight[function]--; inFlight[function] == 0 {
+		delete(inFlight, function)
+	}
+}
+
+// InFlight returns the in-flight calls by function
+func InFlight() map[string]int64 {
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+	return maps.Clone(inFlight)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// content types accepted by POST / (-accept-content-types), all when empty
+var acceptContentTypes ListFlag
+
+// AcceptedContentTypes returns the media types of the allowlist, eg: application/json, text/*
+func AcceptedContentTypes() []string {
+	var types []string
+	for _, value := range acceptContentTypes {
+		for _, mediaType := range strings.Split(value, ",") {
+			if mediaType = strings.ToLower(strings.TrimSpace(mediaType)); mediaType != "" {
+				types = append(types, mediaType)
+			}
+		}
+	}
+	return types
+}
+
+// contentTypeAccepted tells if the Content-Type (application/octet-stream
+// when missing) matches a media type of the allowlist
+func contentTypeAccepted(contentType string, accepted []string) bool {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range accepted {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed || allowed == "*/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptContentTypes answers 415 to the requests with a content type out of the allowlist
+func AcceptContentTypes(next http.HandlerFunc) http.HandlerFunc {
+	accepted := AcceptedContentTypes()
+	if len(accepted) == 0 {
+		return next
+	}
+	return func(response http.ResponseWriter, request *http.Request) {
+		contentType := request.Header.Get("Content-Type")
+		if !contentTypeAccepted(contentType, accepted) {
+			if contentType == "" {
+				contentType = "none"
+			}
+			writeError(response, http.StatusUnsupportedMediaType, CodeUnsupportedType,
+				"unsupported content type: "+contentType+", accepted: "+strings.Join(accepted, ", "))
+			return
+		}
+		next(response, request)
+	}
+}
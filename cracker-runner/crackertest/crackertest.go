@@ -0,0 +1,156 @@
+// Package crackertest serves a handler of the runner in-process and calls
+// it through its HTTP contract, for the integration tests of the runner:
+//
+//	func TestSayHello(t *testing.T) {
+//		mux, _ := NewMux(Routes{Function: "say_hello", EmptyResponseStatus: http.StatusOK})
+//		server := crackertest.Serve(t, mux)
+//		server.Post(t, []byte("Bob")).AssertStatus(t, http.StatusOK).AssertBody(t, "hello Bob")
+//		server.Invoke(t, "nope", nil).AssertStatus(t, http.StatusNotFound).AssertCode(t, "unknown_function")
+//	}
+//
+// The routes of the runner are built in its package main (NewMux): only the
+// tests of cracker-runner serve them; the module has no importable path yet.
+package crackertest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Server is a handler of the runner served for a test
+type Server struct {
+	// base URL of the server, eg: http://127.0.0.1:41234
+	URL    string
+	Client *http.Client
+}
+
+// Serve serves the handler on the loopback interface until the end of the
+// test, which waits for the in-flight requests
+func Serve(t testing.TB, handler http.Handler) *Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &Server{URL: server.URL, Client: server.Client()}
+}
+
+// Response is the answer of a call
+type Response struct {
+	Status int
+	Header http.Header
+	// the body, or the decoded output of POST /invoke
+	Body []byte
+	// the code of the JSON error, empty on success
+	Code string
+}
+
+// Do sends a request to the runner, the body of the response is read
+func (s *Server) Do(t testing.TB, request *http.Request) *Response {
+	t.Helper()
+	response, err := s.Client.Do(request)
+	if err != nil {
+		t.Fatalf("crackertest: %s %s: %v", request.Method, request.URL.Path, err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("crackertest: %s %s: %v", request.Method, request.URL.Path, err)
+	}
+	result := &Response{Status: response.StatusCode, Header: response.Header, Body: body}
+	if strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") && response.StatusCode >= 400 {
+		var failure struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &failure) == nil {
+			result.Code = failure.Error.Code
+		}
+	}
+	return result
+}
+
+// Post calls the default function with the input (POST /)
+func (s *Server) Post(t testing.TB, input []byte) *Response {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodPost, s.URL+"/", bytes.NewReader(input))
+	if err != nil {
+		t.Fatal("crackertest:", err)
+	}
+	request.Header.Set("Content-Type", http.DetectContentType(input))
+	return s.Do(t, request)
+}
+
+// Invoke calls any function of the plugin (POST /invoke): the body of the
+// response is the decoded output, the code is the one of the error
+func (s *Server) Invoke(t testing.TB, function string, input []byte) *Response {
+	t.Helper()
+	envelope, _ := json.Marshal(map[string]string{"function": function, "input": base64.StdEncoding.EncodeToString(input)})
+	request, err := http.NewRequest(http.MethodPost, s.URL+"/invoke", bytes.NewReader(envelope))
+	if err != nil {
+		t.Fatal("crackertest:", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response := s.Do(t, request)
+
+	var invoke struct {
+		Output *string `json:"output"`
+		Error  *struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(response.Body, &invoke); err != nil {
+		t.Fatalf("crackertest: invalid /invoke response %q: %v", response.Body, err)
+	}
+	response.Body = nil
+	if invoke.Error != nil {
+		response.Code = invoke.Error.Code
+	}
+	if invoke.Output != nil {
+		if response.Body, err = base64.StdEncoding.DecodeString(*invoke.Output); err != nil {
+			t.Fatalf("crackertest: invalid /invoke output: %v", err)
+		}
+	}
+	return response
+}
+
+// AssertStatus fails the test when the status of the response is not status
+func (r *Response) AssertStatus(t testing.TB, status int) *Response {
+	t.Helper()
+	if r.Status != status {
+		t.Errorf("status: got %d, want %d (body: %q)", r.Status, status, r.Body)
+	}
+	return r
+}
+
+// AssertBody fails the test when the body of the response is not body
+func (r *Response) AssertBody(t testing.TB, body string) *Response {
+	t.Helper()
+	if string(r.Body) != body {
+		t.Errorf("body: got %q, want %q", r.Body, body)
+	}
+	return r
+}
+
+// AssertContains fails the test when the body doesn't contain substring
+func (r *Response) AssertContains(t testing.TB, substring string) *Response {
+	t.Helper()
+	if !strings.Contains(string(r.Body), substring) {
+		t.Errorf("body: %q doesn't contain %q", r.Body, substring)
+	}
+	return r
+}
+
+// AssertCode fails the test when the error code of the response is not code
+func (r *Response) AssertCode(t testing.TB, code string) *Response {
+	t.Helper()
+	if r.Code != code {
+		t.Errorf("error code: got %q, want %q (body: %q)", r.Code, code, r.Body)
+	}
+	return r
+}
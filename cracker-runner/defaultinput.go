@@ -0,0 +1,16 @@
+package main
+
+// inputs of the calls of a function with an empty input (-default-input),
+// eg: a health-style function called without body
+var defaultInputs = InputFlag{}
+
+// DefaultInput returns the default input of the function when the input is empty
+func DefaultInput(function string, input []byte) []byte {
+	if len(input) > 0 {
+		return input
+	}
+	if defaultInput, ok := defaultInputs[function]; ok {
+		return defaultInput
+	}
+	return input
+}
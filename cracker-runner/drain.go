@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// drain mode: the new plugin requests get a 503 and /readyz too, the
+// in-flight ones finish (blue/green deploys), without shutting down
+var draining atomic.Bool
+
+// in-flight requests of the plugin routes (HTTP and gRPC)
+var pluginRequests atomic.Int64
+
+// DrainResponse is the answer of POST /admin/drain
+type DrainResponse struct {
+	Status string `json:"status"`
+	// in-flight plugin requests, the instance is idle at 0
+	InFlight int64 `json:"inFlight"`
+}
+
+// DrainHandler starts draining the runner (POST /admin/drain), or stops
+// with the body off; the answer gives the remaining in-flight requests,
+// call it again to poll until 0
+func DrainHandler(response http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(request.Body, 16))
+	if err != nil {
+		textError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch strings.TrimSpace(string(body)) {
+	case "", "on":
+		if !draining.Swap(true) {
+			log.Println("🚰 draining, in-flight requests:", pluginRequests.Load())
+		}
+	case "off":
+		if draining.Swap(false) {
+			log.Println("🟢 drain stopped")
+		}
+	default:
+		textError(response, http.StatusBadRequest, "expected on (or nothing) or off")
+		return
+	}
+	drain := DrainResponse{Status: "serving", InFlight: pluginRequests.Load()}
+	if draining.Load() {
+		drain.Status = "draining"
+		if drain.InFlight == 0 {
+			drain.Status = "drained"
+		}
+	}
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(drain)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// the values of the keys (plugin config, response headers) which look like
+// secrets are redacted from GET /admin/config
+var secretKey = regexp.MustCompile(`(?i)secret|token|passw|key|auth|credential|cookie`)
+
+const redacted = "[redacted]"
+
+// ModuleInfo identifies the main module of a loaded plugin
+type ModuleInfo struct {
+	// hash of the main module (hex)
+	SHA256 string `json:"sha256"`
+	// modification time of the wasm file, none for a URL or an inline module
+	ModTime  *time.Time `json:"modTime,omitempty"`
+	LoadedAt time.Time  `json:"loadedAt"`
+}
+
+// NewModuleInfo returns the identity of the main module of the modules of
+// the manifest (wasm is its content)
+func NewModuleInfo(modules []extism.Wasm, wasm []byte) ModuleInfo {
+	sum := sha256.Sum256(wasm)
+	info := ModuleInfo{SHA256: hex.EncodeToString(sum[:]), LoadedAt: time.Now().UTC()}
+	if len(modules) == 0 {
+		return info
+	}
+	if file, ok := modules[mainModule(modules)].(extism.WasmFile); ok {
+		if stat, err := os.Stat(file.Path); err == nil {
+			modTime := stat.ModTime().UTC()
+			info.ModTime = &modTime
+		}
+	}
+	return info
+}
+
+// EffectiveConfig is the configuration of the running instance, served by
+// GET /admin/config
+type EffectiveConfig struct {
+	// every flag with its current value, the secrets redacted
+	Flags map[string]string `json:"flags"`
+	// the flags set on the command line, the others have their default
+	// (some of them from the environment, eg: ADMIN_SECRET)
+	Set  []string `json:"set"`
+	Args []string `json:"args"`
+	// the plugin serving the calls, none when it's not loaded
+	Plugin *LoadedPlugin `json:"plugin"`
+}
+
+// LoadedPlugin is the source and the main module of the stored plugin
+type LoadedPlugin struct {
+	Source string `json:"source"`
+	ModuleInfo
+}
+
+// flagValue returns the value of a flag, without its secrets
+func flagValue(f *flag.Flag) string {
+	value := f.Value.String()
+	switch typed := f.Value.(type) {
+	case ConfigFlag:
+		var values []string
+		for key, value := range typed {
+			if secretKey.MatchString(key) {
+				value = redacted
+			}
+			values = append(values, key+"="+value)
+		}
+		slices.Sort(values)
+		return strings.Join(values, ",")
+	case HeaderFlag:
+		var headers []string
+		for key, values := range typed {
+			for _, value := range values {
+				if secretKey.MatchString(key) {
+					value = redacted
+				}
+				headers = append(headers, key+": "+value)
+			}
+		}
+		slices.Sort(headers)
+		return strings.Join(headers, ", ")
+	}
+	switch {
+	case f.Name == "admin-secret" && value != "":
+		return redacted
+	case f.Name == "reload-webhook" && value != "":
+		// the credentials may be anywhere in the URL (user, path, query)
+		if webhookURL, err := url.Parse(value); err == nil && webhookURL.Host != "" {
+			return webhookURL.Scheme + "://" + webhookURL.Host
+		}
+		return redacted
+	}
+	return value
+}
+
+// CurrentConfig returns the effective configuration of the runner
+func CurrentConfig() EffectiveConfig {
+	config := EffectiveConfig{Flags: map[string]string{}, Set: []string{}, Args: flag.Args()}
+	flag.VisitAll(func(f *flag.Flag) {
+		config.Flags[f.Name] = flagValue(f)
+	})
+	flag.Visit(func(f *flag.Flag) {
+		config.Set = append(config.Set, f.Name)
+	})
+	if inst, err := acquire(); err == nil {
+		config.Plugin = &LoadedPlugin{Source: currentSource().String(), ModuleInfo: inst.module}
+		inst.release()
+	}
+	return config
+}
+
+// ConfigHandler serves the effective configuration, the secrets redacted
+// (GET /admin/config)
+func ConfigHandler(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(response)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(CurrentConfig())
+}
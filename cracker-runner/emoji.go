@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// no emoji in the logs and the error messages (-no-emoji)
+var noEmoji bool
+
+// template of the plain text error bodies (-error-template), nil for
+// the default "😡 Error: <message>"
+var errorTemplate *template.Template
+
+// ErrorText is the data of the -error-template
+type ErrorText struct {
+	Status     int
+	StatusText string
+	Message    string
+}
+
+// LoadErrorTemplate parses a text/template file of the plain text error bodies,
+// eg: Fehler {{.Status}}: {{.Message}}
+func LoadErrorTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New("error").Option("missingkey=error").Parse(string(data))
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) || (r >= 0x2300 && r <= 0x23FF) ||
+		r == 0xFE0F || r == 0x200D
+}
+
+// StripEmoji removes the emoji of the text, and the space following each one
+func StripEmoji(text string) string {
+	var stripped strings.Builder
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		if !isEmoji(r) {
+			stripped.WriteRune(r)
+			continue
+		}
+		// the rest of the sequence (variation selector, joiner...) then one space
+		for i < len(text) {
+			next, size := utf8.DecodeRuneInString(text[i:])
+			if !isEmoji(next) {
+				break
+			}
+			i += size
+		}
+		if i < len(text) && text[i] == ' ' {
+			i++
+		}
+	}
+	return stripped.String()
+}
+
+// ErrorMessage returns the message of an error answer, without emoji with -no-emoji
+func ErrorMessage(message string) string {
+	if noEmoji {
+		return StripEmoji(message)
+	}
+	return message
+}
+
+// textError answers a plain text error (admin routes): the -error-template,
+// or "😡 Error: <message>" ("Error: <message>" with -no-emoji)
+func textError(response http.ResponseWriter, status int, message string) {
+	text := "😡 Error: " + message
+	if errorTemplate != nil {
+		var rendered strings.Builder
+		if err := errorTemplate.Execute(&rendered, ErrorText{status, http.StatusText(status), message}); err == nil {
+			text = rendered.String()
+		}
+	}
+	http.Error(response, ErrorMessage(text), status)
+}
+
+// emojiWriter strips the emoji of the logs (-no-emoji)
+type emojiWriter struct {
+	io.Writer
+}
+
+func (w emojiWriter) Write(data []byte) (int, error) {
+	if _, err := w.Writer.Write([]byte(StripEmoji(string(data)))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+var ErrNoPlugin = errors.New("🔴 no plugin")
+
+// stable codes of the JSON errors, clients can rely on them
+const (
+	CodeInvalidRequest  = "invalid_request"
+	CodeInvalidFunction = "invalid_function"
+	CodeInvalidInput    = "invalid_input"
+	CodeUnknownFunction = "unknown_function"
+	CodeCallFailed      = "call_failed"
+	CodeInputTooLarge   = "input_too_large"
+	CodeOutputTooLarge  = "output_too_large"
+	CodeInputSchema     = "input_schema"
+	CodeCallTimeout     = "call_timeout"
+	CodeNoSchema        = "no_schema"
+	CodeNoSection       = "no_section"
+	CodeUnsupportedType = "unsupported_media_type"
+	// the reloaded plugin failed to build, the current one still serves
+	CodeReloadFailed = "reload_failed"
+	// the body of the reload names a source out of -allowed-reload-source
+	CodeSourceNotAllowed = "source_not_allowed"
+	// transient: the plugin is not loaded yet, retry later
+	CodeNoPlugin     = "no_plugin"
+	CodeMaintenance  = "maintenance"
+	CodeShuttingDown = "shutting_down"
+	CodeDraining     = "draining"
+	CodeReloading    = "reloading"
+	CodeCircuitOpen  = "circuit_open"
+	CodeTooManyCalls = "too_many_calls"
+	CodePoolBusy     = "pool_busy"
+	// the plugin classified the failure (errorKind)
+	CodePluginRetryable = "plugin_retryable"
+	CodePluginFatal     = "plugin_fatal"
+	// an exit code mapped with -exit-code-map
+	CodePluginExitCode = "plugin_exit_code"
+)
+
+// ErrorResponse is the JSON answer of a failed plugin route
+type ErrorResponse struct {
+	Error InvokeError `json:"error"`
+}
+
+// RequestError is an invalid request, answered with its status and code
+type RequestError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// callStatus returns the HTTP status and error code of a failed call
+func callStatus(err error) (int, string) {
+	var requestError *RequestError
+	var pluginErr *PluginError
+	var exitErr *ExitCodeError
+	switch {
+	case errors.As(err, &requestError):
+		return requestError.Status, requestError.Code
+	case errors.As(err, &exitErr):
+		return exitErr.Status, CodePluginExitCode
+	case errors.As(err, &pluginErr) && pluginErr.Kind == ErrorKindRetryable:
+		return http.StatusServiceUnavailable, CodePluginRetryable
+	case errors.As(err, &pluginErr):
+		return http.StatusBadRequest, CodePluginFatal
+	case errors.Is(err, ErrNoPlugin):
+		return http.StatusServiceUnavailable, CodeNoPlugin
+	case errors.Is(err, ErrReloading):
+		return http.StatusServiceUnavailable, CodeReloading
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable, CodeCircuitOpen
+	case errors.Is(err, ErrPoolBusy):
+		return http.StatusServiceUnavailable, CodePoolBusy
+	case errors.Is(err, ErrUnknownFunction):
+		return http.StatusNotFound, CodeUnknownFunction
+	case errors.Is(err, ErrCallTimeout):
+		return http.StatusGatewayTimeout, CodeCallTimeout
+	case errors.Is(err, ErrTooManyCalls):
+		return http.StatusTooManyRequests, CodeTooManyCalls
+	case errors.Is(err, ErrInputTooLarge):
+		return http.StatusRequestEntityTooLarge, CodeInputTooLarge
+	case errors.Is(err, ErrInputSchema):
+		return http.StatusBadRequest, CodeInputSchema
+	case errors.Is(err, ErrOutputTooLarge):
+		return http.StatusInternalServerError, CodeOutputTooLarge
+	default:
+		return http.StatusInternalServerError, CodeCallFailed
+	}
+}
+
+func writeError(response http.ResponseWriter, status int, code string, message string) {
+	if status == http.StatusServiceUnavailable {
+		response.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	json.NewEncoder(response).Encode(ErrorResponse{Error: InvokeError{Code: code, Message: ErrorMessage(message)}})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// HTTP statuses of the non-zero exit codes of the plugin functions
+// (-exit-code-map 2=400,3=404), the other exit codes keep their behavior
+var exitCodeMap = ExitCodeMap{}
+
+// ExitCodeMap is a repeatable, comma separated code=status flag
+type ExitCodeMap map[uint32]int
+
+func (e ExitCodeMap) String() string {
+	var codes []string
+	for code, status := range e {
+		codes = append(codes, fmt.Sprintf("%d=%d", code, status))
+	}
+	slices.Sort(codes)
+	return strings.Join(codes, ",")
+}
+
+func (e ExitCodeMap) Set(value string) error {
+	for pair := range strings.SplitSeq(value, ",") {
+		code, status, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("expected code=status, got %q", pair)
+		}
+		exitCode, err := strconv.ParseUint(code, 10, 32)
+		if err != nil || exitCode == 0 {
+			return fmt.Errorf("invalid exit code %q: expected a non-zero exit code", code)
+		}
+		httpStatus, err := strconv.Atoi(status)
+		if err != nil || httpStatus < 200 || httpStatus > 599 {
+			return fmt.Errorf("invalid status %q for the exit code %s", status, code)
+		}
+		e[uint32(exitCode)] = httpStatus
+	}
+	return nil
+}
+
+// ExitCodeError is a call ended with a mapped exit code: an outcome of the
+// plugin (eg: not found), answered with its status and the output
+type ExitCodeError struct {
+	Function string
+	Code     uint32
+	Status   int
+	Output   []byte
+	// error message of the plugin, if any
+	Err error
+}
+
+func (e *ExitCodeError) Error() string {
+	message := fmt.Sprintf("%s exited with code %d", e.Function, e.Code)
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
+// exitCodeError returns the ExitCodeError of a mapped exit code, nil otherwise
+func exitCodeError(function string, exitCode uint32, out []byte, err error) *ExitCodeError {
+	status, ok := exitCodeMap[exitCode]
+	if !ok {
+		return nil
+	}
+	return &ExitCodeError{Function: function, Code: exitCode, Status: status, Output: out, Err: err}
+}
+
+// grpcCode returns the gRPC code of the HTTP status of a mapped exit code
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if status < 400 {
+		return codes.OK
+	}
+	return codes.Unknown
+}
+
+// asExitCode returns the ExitCodeError of the error of a call
+func asExitCode(err error) (*ExitCodeError, bool) {
+	var exitErr *ExitCodeError
+	ok := errors.As(err, &exitErr)
+	return exitErr, ok
+}
+
+func isExitCode(err error) bool {
+	_, ok := asExitCode(err)
+	return ok
+}
+
+// SetExitCode sets the X-Exit-Code header of a call ended with a mapped exit code
+func SetExitCode(response http.ResponseWriter, err error) {
+	if exitErr, ok := asExitCode(err); ok {
+		response.Header().Set("X-Exit-Code", strconv.FormatUint(uint64(exitErr.Code), 10))
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// JSONSchema is the part of a JSON Schema the client generator maps to Go types
+type JSONSchema struct {
+	// a type name, or a list of type names (eg: ["string","null"])
+	Type        any                    `json:"type"`
+	Description string                 `json:"description"`
+	Properties  map[string]*JSONSchema `json:"properties"`
+	Required    []string               `json:"required"`
+	Items       *JSONSchema            `json:"items"`
+}
+
+// FunctionSchema is the output of the _schema function of the plugin
+type FunctionSchema struct {
+	Input  *JSONSchema `json:"input"`
+	Output *JSONSchema `json:"output"`
+}
+
+// ClientFunction is a function of the generated client, without schema
+// its input and output are []byte
+type ClientFunction struct {
+	Name   string
+	Schema FunctionSchema
+}
+
+// typeName returns the JSON type of the schema, the first one which is not null
+func (schema *JSONSchema) typeName() string {
+	switch types := schema.Type.(type) {
+	case string:
+		return types
+	case []any:
+		for _, value := range types {
+			if name, ok := value.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	if len(schema.Properties) > 0 {
+		return "object"
+	}
+	return ""
+}
+
+// the Go initialisms of the generated names
+var initialisms = []string{"ID", "URL", "URI", "HTTP", "JSON", "API", "UUID", "IP"}
+
+// goName returns the exported Go name of a function or a property (say_hello: SayHello)
+func goName(name string) string {
+	var result strings.Builder
+	for part := range strings.FieldsFuncSeq(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if slices.Contains(initialisms, strings.ToUpper(part)) {
+			result.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		result.WriteString(string(runes))
+	}
+	if result.Len() == 0 || unicode.IsDigit(rune(result.String()[0])) {
+		return "F" + result.String()
+	}
+	return result.String()
+}
+
+// clientWriter writes the methods and the types of the generated client
+type clientWriter struct {
+	methods strings.Builder
+	types   strings.Builder
+	// declared names: methods of the client and types
+	names map[string]bool
+}
+
+// unique returns the name, with a number when it's already declared
+func (w *clientWriter) unique(name string) string {
+	unique := name
+	for i := 2; w.names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	w.names[unique] = true
+	return unique
+}
+
+// goType returns the Go type of a schema, the objects with properties are
+// declared as structs named after name
+func (w *clientWriter) goType(schema *JSONSchema, name string) string {
+	if schema == nil {
+		return "json.RawMessage"
+	}
+	switch schema.typeName() {
+	case "string":
+		return "string"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + w.goType(schema.Items, name+"Item")
+	case "object":
+		if len(schema.Properties) == 0 {
+			return "map[string]any"
+		}
+		return w.declareStruct(schema, name)
+	}
+	return "json.RawMessage"
+}
+
+// declareStruct declares the struct of an object schema, the optional
+// properties are omitted when empty
+func (w *clientWriter) declareStruct(schema *JSONSchema, name string) string {
+	name = w.unique(name)
+	var fields strings.Builder
+	for _, property := range slices.Sorted(maps.Keys(schema.Properties)) {
+		field := schema.Properties[property]
+		fieldName := goName(property)
+		fieldType, tag := w.goType(field, name+fieldName), property
+		if !slices.Contains(schema.Required, property) {
+			tag += ",omitempty"
+			// omitempty doesn't omit a struct
+			if w.names[fieldType] {
+				fieldType = "*" + fieldType
+			}
+		}
+		if field != nil && field.Description != "" {
+			fmt.Fprintf(&fields, "// %s\n", oneLine(field.Description))
+		}
+		fmt.Fprintf(&fields, "%s %s `json:%q`\n", fieldName, fieldType, tag)
+	}
+	if schema.Description != "" {
+		fmt.Fprintf(&w.types, "// %s\n", oneLine(schema.Description))
+	}
+	fmt.Fprintf(&w.types, "type %s struct {\n%s}\n\n", name, fields.String())
+	return name
+}
+
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// method writes the typed method of a function: no schema is []byte, a
+// string is the raw text, the other types are JSON encoded
+func (w *clientWriter) method(function ClientFunction) {
+	name := w.unique(goName(function.Name))
+	inputType, outputType := "[]byte", "[]byte"
+	if function.Schema.Input != nil {
+		inputType = w.goType(function.Schema.Input, name+"Input")
+	}
+	if function.Schema.Output != nil {
+		outputType = w.goType(function.Schema.Output, name+"Output")
+	}
+
+	fmt.Fprintf(&w.methods, "// %s calls the %s function of the plugin\n", name, function.Name)
+	fmt.Fprintf(&w.methods, "func (c *Client) %s(ctx context.Context, input %s) (%s, error) {\n", name, inputType, outputType)
+	fmt.Fprintf(&w.methods, "var output %s\n", outputType)
+	switch inputType {
+	case "[]byte":
+		w.methods.WriteString("data := input\n")
+	case "string":
+		w.methods.WriteString("data := []byte(input)\n")
+	default:
+		w.methods.WriteString("data, err := json.Marshal(input)\nif err != nil {\nreturn output, err\n}\n")
+	}
+	fmt.Fprintf(&w.methods, "out, err := c.Invoke(ctx, %q, data)\nif err != nil {\nreturn output, err\n}\n", function.Name)
+	switch outputType {
+	case "[]byte":
+		w.methods.WriteString("output = out\n")
+	case "string":
+		w.methods.WriteString("output = string(out)\n")
+	default:
+		w.methods.WriteString("err = json.Unmarshal(out, &output)\n")
+	}
+	w.methods.WriteString("return output, err\n}\n\n")
+}
+
+// the fixed part of the generated client: the /invoke envelope
+const clientHeader = `// Code generated by cracker-runner gen-client. DO NOT EDIT.
+
+package %s
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Client calls the functions of the plugin through the POST /invoke
+// endpoint of a cracker-runner
+type Client struct {
+	// URL of the runner, with its base path, eg: http://localhost:8080
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// New returns a client of the runner at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: http.DefaultClient}
+}
+
+// Error is a failed call, Code is the stable error code of the runner
+type Error struct {
+	Status  int    ` + "`json:\"-\"`" + `
+	Code    string ` + "`json:\"code\"`" + `
+	Message string ` + "`json:\"message\"`" + `
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%%s (%%d): %%s", e.Code, e.Status, e.Message)
+}
+
+// Invoke calls a function of the plugin with a raw input
+func (c *Client) Invoke(ctx context.Context, function string, input []byte) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{"function": function, "input": base64.StdEncoding.EncodeToString(input)})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+"/invoke", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var envelope struct {
+		Output *string ` + "`json:\"output\"`" + `
+		Error  *Error  ` + "`json:\"error\"`" + `
+	}
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("%%s: %%s", function, response.Status)
+	}
+	if envelope.Error != nil {
+		envelope.Error.Status = response.StatusCode
+		return nil, envelope.Error
+	}
+	if envelope.Output == nil {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(*envelope.Output)
+}
+
+`
+
+// GenerateClient returns the source of a Go client of the functions
+func GenerateClient(packageName string, functions []ClientFunction) ([]byte, error) {
+	w := &clientWriter{names: map[string]bool{"Invoke": true}}
+	for _, function := range functions {
+		w.method(function)
+	}
+	source := fmt.Sprintf(clientHeader, packageName) + w.methods.String() + w.types.String()
+	return format.Source([]byte(source))
+}
+
+// FunctionSchemas returns the functions of the stored plugin with their
+// schema (_schema function), when the plugin describes them
+func FunctionSchemas(ctx context.Context, functions []string) []ClientFunction {
+	plugin, err := GetPlugin()
+	hasSchema := err == nil && plugin.FunctionExists(schemaFunction)
+	var clientFunctions []ClientFunction
+	for _, function := range functions {
+		clientFunction := ClientFunction{Name: function}
+		if hasSchema {
+			callCtx, cancel, _ := WithCallTimeout(ctx, callTimeout)
+			schema, err := CallPlugin(callCtx, schemaFunction, []byte(function))
+			cancel()
+			switch {
+			case err != nil:
+				log.Println("🟡 no schema for", function, err)
+			case len(schema) == 0:
+			case json.Unmarshal(schema, &clientFunction.Schema) != nil:
+				log.Println("🟡 the schema of", function, "is not valid JSON")
+			}
+		}
+		clientFunctions = append(clientFunctions, clientFunction)
+	}
+	return clientFunctions
+}
+
+// genClient runs the gen-client subcommand:
+// cracker-runner gen-client -wasm plugin.wasm -package client -o client/client.go
+func genClient(arguments []string) {
+	flags := flag.NewFlagSet("gen-client", flag.ExitOnError)
+	wasmFilePath := flags.String("wasm", "", "wasm file of the plugin")
+	manifestPath := flags.String("manifest", "", "Extism manifest (JSON) of the plugin, instead of -wasm")
+	pluginConfig := ConfigFlag{}
+	flags.Var(pluginConfig, "plugin-config", "key=value config of the plugin, repeatable")
+	var functions ListFlag
+	flags.Var(&functions, "fn", "function of the client, repeatable (default: all the exported functions)")
+	packageName := flags.String("package", "client", "package of the generated client")
+	output := flags.String("o", "client.go", "generated Go file")
+	flags.Parse(arguments)
+
+	if (*wasmFilePath == "") == (*manifestPath == "") || !token.IsIdentifier(*packageName) {
+		log.Fatalln("😡: usage: cracker-runner gen-client (-wasm plugin.wasm | -manifest manifest.json) [-fn function] [-package client] [-o client.go]")
+	}
+
+	ctx := context.Background()
+	source := PluginSource{
+		ManifestPath: *manifestPath,
+		WasmFilePath: *wasmFilePath,
+		Config:       pluginConfig,
+	}
+	pluginSource = source
+	pluginInst, err := LoadPlugin(ctx, source)
+	if err != nil {
+		log.Fatalln("🔴 !!! Error when loading the plugin", err)
+	}
+	StorePlugin(pluginInst)
+
+	if len(functions) == 0 {
+		functions = exportedFunctions(pluginInst)
+	}
+	for _, function := range functions {
+		if !pluginInst.plugin.FunctionExists(function) {
+			log.Fatalln("😡:", ErrUnknownFunction, function)
+		}
+	}
+
+	code, err := GenerateClient(*packageName, FunctionSchemas(ctx, functions))
+	if err != nil {
+		log.Fatalln("🔴 !!! Error when generating the client", err)
+	}
+	if err := os.WriteFile(*output, code, 0644); err != nil {
+		log.Fatalln("🔴 !!! Error when writing the client", err)
+	}
+	log.Printf("📝 client of %d functions written to %s", len(functions), *output)
+}
@@ -0,0 +1,113 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative runnerpb/runner.proto
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"cracker-runner/runnerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// runnerServer serves the functions of the plugin over gRPC,
+// the calls go through CallPlugin like the HTTP ones
+type runnerServer struct {
+	runnerpb.UnimplementedRunnerServer
+}
+
+func (s *runnerServer) Invoke(ctx context.Context, request *runnerpb.InvokeRequest) (*runnerpb.InvokeResponse, error) {
+	if maintenance.Load() {
+		return nil, status.Error(codes.Unavailable, "the runner is in maintenance mode")
+	}
+	if shuttingDown.Load() {
+		return nil, status.Error(codes.Unavailable, "the runner is shutting down")
+	}
+	if draining.Load() {
+		return nil, status.Error(codes.Unavailable, "the runner is draining")
+	}
+	pluginRequests.Add(1)
+	defer pluginRequests.Add(-1)
+	if !functionName.MatchString(request.GetFunction()) {
+		return nil, status.Error(codes.InvalidArgument, "invalid function name: "+request.GetFunction())
+	}
+	// the x-request-id metadata, or a new id
+	id := NewRequestID()
+	if ids := metadata.ValueFromIncomingContext(ctx, "x-request-id"); len(ids) > 0 && validRequestID.MatchString(ids[0]) {
+		id = ids[0]
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+
+	// the deadline of the client, clamped to -max-call-timeout
+	var client time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		client = time.Until(deadline)
+	}
+	ctx, cancel, _ := WithCallTimeout(ctx, CallTimeout(client))
+	defer cancel()
+
+	out, err := CallPlugin(ctx, request.GetFunction(), request.GetInput())
+	if exitErr, ok := asExitCode(err); ok {
+		grpc.SetHeader(ctx, metadata.Pairs("x-exit-code", strconv.FormatUint(uint64(exitErr.Code), 10)))
+		if code := grpcCode(exitErr.Status); code != codes.OK {
+			return nil, status.Error(code, ErrorMessage(exitErr.Error()))
+		}
+		return &runnerpb.InvokeResponse{Output: exitErr.Output}, nil
+	}
+	if errors.Is(err, ErrNoPlugin) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrReloading) || errors.Is(err, ErrPoolBusy) || isRetryable(err) {
+		return nil, status.Error(codes.Unavailable, ErrorMessage(err.Error()))
+	}
+	if errors.Is(err, ErrCallTimeout) {
+		return nil, status.Error(codes.DeadlineExceeded, ErrorMessage(err.Error()))
+	}
+	if errors.Is(err, ErrCallCanceled) {
+		return nil, status.Error(codes.Canceled, ErrorMessage(err.Error()))
+	}
+	if errors.Is(err, ErrInputTooLarge) || errors.Is(err, ErrTooManyCalls) {
+		return nil, status.Error(codes.ResourceExhausted, ErrorMessage(err.Error()))
+	}
+	var pluginErr *PluginError
+	if errors.As(err, &pluginErr) || errors.Is(err, ErrInputSchema) {
+		return nil, status.Error(codes.InvalidArgument, ErrorMessage(err.Error()))
+	}
+	if errors.Is(err, ErrUnknownFunction) {
+		return nil, status.Error(codes.NotFound, ErrorMessage(err.Error()))
+	}
+	if err != nil {
+		log.Println("🔴 !!! Error when calling", request.GetFunction(), err)
+		return nil, status.Error(codes.Internal, ErrorMessage(err.Error()))
+	}
+	return &runnerpb.InvokeResponse{Output: out}, nil
+}
+
+// NewGRPCServer returns a server of the Runner gRPC service
+func NewGRPCServer() *grpc.Server {
+	// the input limits are checked by Invoke
+	limit := envelopeLimit()
+	if limit == 0 {
+		limit = math.MaxInt32
+	}
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(int(limit)))
+	runnerpb.RegisterRunnerServer(server, &runnerServer{})
+	return server
+}
+
+// ServeGRPC serves the gRPC server on addr, eg: ":9090"
+func ServeGRPC(server *grpc.Server, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Println("🌍 grpc server is listening on: " + addr)
+	return server.Serve(listener)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// self-check of the plugin for /readyz (-health-function), disabled when empty
+var healthFunction string
+
+// expected output of the health function
+var healthExpect = "OK"
+
+// deadline of the health call, and how long its result is reused
+var healthTimeout = time.Second
+var healthCacheTTL = 5 * time.Second
+
+var health struct {
+	sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// PluginHealth calls the health function of the plugin with an empty input
+// and checks its output; the result is cached for healthCacheTTL, the
+// concurrent checks wait for the running one
+func PluginHealth() error {
+	if healthFunction == "" {
+		return nil
+	}
+	health.Lock()
+	defer health.Unlock()
+	if time.Since(health.checked) < healthCacheTTL {
+		return health.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	result := make(chan error, 1)
+	// the instance may be busy: don't wait for it past the deadline
+	go func() {
+		out, err := healthCall(ctx)
+		if err == nil && !bytes.Equal(bytes.TrimSpace(out), []byte(healthExpect)) {
+			err = fmt.Errorf("%s answered %q, expected %q", healthFunction, out, healthExpect)
+		}
+		result <- err
+	}()
+	select {
+	case health.err = <-result:
+	case <-ctx.Done():
+		health.err = fmt.Errorf("%s: no answer after %s", healthFunction, healthTimeout)
+	}
+	health.checked = time.Now()
+	if health.err != nil {
+		log.Println("🟡 not ready:", health.err)
+	}
+	return health.err
+}
+
+// healthCall calls the health function on an instance of the calls, out of
+// /stats and the breaker; ctx only bounds the wait for the instance: a slow
+// probe answers unhealthy without closing the module (CloseOnContextDone)
+func healthCall(ctx context.Context) ([]byte, error) {
+	var inst *instance
+	if freshInstance || poolMax > 0 {
+		stored, err := acquire()
+		if err != nil {
+			return nil, err
+		}
+		defer stored.release()
+		if freshInstance {
+			if inst, err = stored.fresh(ctx); err != nil {
+				return nil, err
+			}
+			defer inst.close(context.Background())
+		} else {
+			if inst, err = stored.pool.get(ctx); err != nil {
+				return nil, err
+			}
+			defer stored.pool.put(inst)
+		}
+	} else {
+		var err error
+		if inst, err = lockInstance(); err != nil {
+			return nil, err
+		}
+		defer inst.release()
+		defer inst.mutex.Unlock()
+	}
+
+	if !inst.plugin.FunctionExists(healthFunction) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFunction, healthFunction)
+	}
+	inst.startGuestLogs(ctx, healthFunction)
+	rc, out, err := inst.plugin.CallWithContext(context.WithoutCancel(ctx), healthFunction, DefaultInput(healthFunction, nil))
+	if err == nil && rc != 0 {
+		err = fmt.Errorf("%s: exit code %d", healthFunction, rc)
+	}
+	return out, err
+}
+
+// resetHealth forgets the cached result (eg: after a reload)
+func resetHealth() {
+	health.Lock()
+	defer health.Unlock()
+	health.checked = time.Time{}
+}
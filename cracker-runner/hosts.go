@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// log the outbound requests of the plugin denied by the allowed hosts (-log-denied-hosts)
+var logDeniedHosts bool
+
+// error of the http_request host function of Extism for a host out of the allowed hosts
+var deniedRequest = regexp.MustCompile(`HTTP request to '([^']*)' is not allowed`)
+
+// logDeniedHost logs the target host of the call error when the plugin
+// tried an outbound request out of the allowed hosts
+func logDeniedHost(ctx context.Context, inst *instance, functionName string, err error) {
+	match := deniedRequest.FindStringSubmatch(err.Error())
+	if match == nil {
+		return
+	}
+	host := match[1]
+	if target, err := url.Parse(match[1]); err == nil && target.Hostname() != "" {
+		host = target.Hostname()
+	}
+	log.Printf("⚠️ [%s] plugin %s (%s): denied outbound request to %s, allowed hosts: %s",
+		RequestID(ctx), inst.name, functionName, host, strings.Join(inst.plugin.AllowedHosts, ", "))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// JSON Schema files of the inputs by function (-input-schema fn=schema.json),
+// the functions without a schema are not validated
+var inputSchemaPaths = ConfigFlag{}
+
+// compiled input schemas by function
+var inputSchemas = map[string]*jsonschema.Schema{}
+
+var ErrInputSchema = errors.New("input doesn't match the schema")
+
+// LoadInputSchemas compiles the -input-schema files
+func LoadInputSchemas(paths map[string]string) (map[string]*jsonschema.Schema, error) {
+	schemas := map[string]*jsonschema.Schema{}
+	for function, path := range paths {
+		if !functionName.MatchString(function) {
+			return nil, fmt.Errorf("invalid function name: %q", function)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		document, err := jsonschema.UnmarshalJSON(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("schema of %s: %w", function, err)
+		}
+		compiler := jsonschema.NewCompiler()
+		if err := compiler.AddResource(path, document); err != nil {
+			return nil, fmt.Errorf("schema of %s: %w", function, err)
+		}
+		if schemas[function], err = compiler.Compile(path); err != nil {
+			return nil, fmt.Errorf("schema of %s: %w", function, err)
+		}
+	}
+	return schemas, nil
+}
+
+// CheckInputSchema validates the input of the function against its schema,
+// the error lists the failures with their location in the input
+func CheckInputSchema(function string, input []byte) error {
+	schema, ok := inputSchemas[function]
+	if !ok {
+		return nil
+	}
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(input))
+	if err != nil {
+		stats.Rejected(function)
+		return fmt.Errorf("%w of %s: invalid JSON: %v", ErrInputSchema, function, err)
+	}
+	err = schema.Validate(document)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+	stats.Rejected(function)
+	var failures []string
+	for _, unit := range validationErr.BasicOutput().Errors {
+		if unit.Error != nil {
+			failures = append(failures, fmt.Sprintf("at '%s': %s", unit.InstanceLocation, unit.Error))
+		}
+	}
+	return fmt.Errorf("%w of %s: %s", ErrInputSchema, function, strings.Join(failures, "; "))
+}
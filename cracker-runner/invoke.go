@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// InvokeRequest is the envelope of a POST /invoke call
+type InvokeRequest struct {
+	Function string `json:"function"`
+	// base64 encoded input of the function
+	Input string `json:"input"`
+	// HTTP method given to the plugin with -method-header, default POST
+	Method string `json:"method,omitempty"`
+}
+
+// InvokeResponse is the envelope of the answer of a POST /invoke call
+type InvokeResponse struct {
+	// base64 encoded output of the function
+	Output *string      `json:"output"`
+	Error  *InvokeError `json:"error"`
+}
+
+type InvokeError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// valid names of the exported wasm functions
+var functionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// InvokeHandler calls any function of the plugin with the uniform RPC-style contract:
+// {"function":"say_hello","input":"<base64>"} => {"output":"<base64>","error":null}
+func InvokeHandler(response http.ResponseWriter, request *http.Request) {
+	function, method, input, err := decodeInvoke(response, request)
+	if err != nil {
+		status, code := callStatus(err)
+		writeInvokeError(response, status, code, err.Error())
+		return
+	}
+
+	ctx, cancel, err := callContext(request)
+	if err != nil {
+		writeInvokeError(response, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	defer cancel()
+	if method != "" {
+		ctx = WithMethod(ctx, method)
+	}
+
+	out, err := CallPlugin(ctx, function, input)
+	if exitErr, ok := asExitCode(err); ok {
+		// the output of a mapped exit code comes with the error
+		log.Println("🟡", exitErr)
+		SetExitCode(response, exitErr)
+		invokeResponse := InvokeResponse{Error: &InvokeError{Code: CodePluginExitCode, Message: ErrorMessage(exitErr.Error())}}
+		if len(exitErr.Output) > 0 {
+			output := base64.StdEncoding.EncodeToString(exitErr.Output)
+			invokeResponse.Output = &output
+		}
+		writeInvokeResponse(response, exitErr.Status, invokeResponse)
+		return
+	}
+	if err != nil {
+		log.Println("🔴 !!! Error when calling", function, err)
+		status, code := callStatus(err)
+		writeInvokeError(response, status, code, err.Error())
+		return
+	}
+
+	// the checksum of the decoded output
+	SetChecksum(response, out)
+	output := base64.StdEncoding.EncodeToString(out)
+	writeInvokeResponse(response, http.StatusOK, InvokeResponse{Output: &output})
+}
+
+// decodeInvoke returns the function, the method and the decoded input of the JSON envelope
+func decodeInvoke(response http.ResponseWriter, request *http.Request) (string, string, []byte, error) {
+	var invoke InvokeRequest
+	body := request.Body
+	if limit := envelopeLimit(); limit > 0 {
+		body = http.MaxBytesReader(response, request.Body, limit)
+	}
+	if err := json.NewDecoder(body).Decode(&invoke); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return "", "", nil, &RequestError{http.StatusRequestEntityTooLarge, CodeInputTooLarge, err.Error()}
+		}
+		return "", "", nil, &RequestError{http.StatusBadRequest, CodeInvalidRequest, "invalid JSON envelope: " + err.Error()}
+	}
+	if !functionName.MatchString(invoke.Function) {
+		return "", "", nil, &RequestError{http.StatusBadRequest, CodeInvalidFunction, "invalid function name: " + invoke.Function}
+	}
+	if invoke.Method != "" && !httpMethod.MatchString(invoke.Method) {
+		return "", "", nil, &RequestError{http.StatusBadRequest, CodeInvalidRequest, "invalid method: " + invoke.Method}
+	}
+	input, err := base64.StdEncoding.DecodeString(invoke.Input)
+	if err != nil {
+		return "", "", nil, &RequestError{http.StatusBadRequest, CodeInvalidInput, "input is not valid base64: " + err.Error()}
+	}
+	return invoke.Function, invoke.Method, input, nil
+}
+
+func writeInvokeError(response http.ResponseWriter, status int, code string, message string) {
+	writeInvokeResponse(response, status, InvokeResponse{Error: &InvokeError{Code: code, Message: ErrorMessage(message)}})
+}
+
+func writeInvokeResponse(response http.ResponseWriter, status int, invokeResponse InvokeResponse) {
+	if status == http.StatusServiceUnavailable {
+		response.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	json.NewEncoder(response).Encode(invokeResponse)
+}
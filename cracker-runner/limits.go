@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maximum size of the input of a call, for all the functions (-max-body-bytes)
+var maxBodyBytes int64 = 10 << 20
+
+// per-function maximum sizes, overriding maxBodyBytes (-max-input-bytes fn=bytes)
+var maxInputBytes = FunctionFlag{}
+
+var ErrInputTooLarge = errors.New("input too large")
+
+// maximum size of the output of a call, the larger outputs are dropped
+// instead of being written (-max-output-bytes, 0 = unlimited)
+var maxOutputBytes int64
+
+var ErrOutputTooLarge = errors.New("output too large")
+
+// FunctionFlag is a repeatable fn=value flag
+type FunctionFlag map[string]int64
+
+func (f FunctionFlag) String() string {
+	var values []string
+	for name, value := range f {
+		values = append(values, name+"="+strconv.FormatInt(value, 10))
+	}
+	return strings.Join(values, ",")
+}
+
+func (f FunctionFlag) Set(value string) error {
+	name, number, ok := strings.Cut(value, "=")
+	if !ok || !functionName.MatchString(name) {
+		return fmt.Errorf("expected function=value, got %q", value)
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid value for %s: %q", name, number)
+	}
+	f[name] = n
+	return nil
+}
+
+// InputLimit returns the maximum input size of the function (0 = unlimited)
+func InputLimit(function string) int64 {
+	if limit, ok := maxInputBytes[function]; ok {
+		return limit
+	}
+	return maxBodyBytes
+}
+
+// CheckInputSize returns ErrInputTooLarge when the input exceeds the limit of the function
+func CheckInputSize(function string, size int64) error {
+	if limit := InputLimit(function); limit > 0 && size > limit {
+		stats.Rejected(function)
+		return fmt.Errorf("%w: %d bytes, the limit of %s is %d bytes", ErrInputTooLarge, size, function, limit)
+	}
+	return nil
+}
+
+// CheckOutputSize returns ErrOutputTooLarge when the output of the function exceeds -max-output-bytes
+func CheckOutputSize(function string, size int64) error {
+	if maxOutputBytes > 0 && size > maxOutputBytes {
+		return fmt.Errorf("%w: %s returned %d bytes, the limit is %d bytes", ErrOutputTooLarge, function, size, maxOutputBytes)
+	}
+	return nil
+}
+
+// ReadInput reads the body of a call of the function within its input limit
+func ReadInput(response http.ResponseWriter, request *http.Request, function string) ([]byte, error) {
+	input, err := io.ReadAll(LimitBody(response, request, function))
+	return input, bodyError(function, err)
+}
+
+// LimitBody returns the body of a call of the function, limited to its input limit
+func LimitBody(response http.ResponseWriter, request *http.Request, function string) io.ReadCloser {
+	if limit := InputLimit(function); limit > 0 {
+		return http.MaxBytesReader(response, request.Body, limit)
+	}
+	return request.Body
+}
+
+// bodyError returns ErrInputTooLarge when the error is about the limit of the body
+func bodyError(function string, err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		stats.Rejected(function)
+		return fmt.Errorf("%w: the limit of %s is %d bytes", ErrInputTooLarge, function, maxBytesError.Limit)
+	}
+	return err
+}
+
+// envelopeLimit is the maximum size of a base64 JSON envelope (0 = unlimited):
+// large enough for the largest input limit of the functions
+func envelopeLimit() int64 {
+	largest := maxBodyBytes
+	for _, limit := range maxInputBytes {
+		if largest == 0 || limit == 0 {
+			return 0
+		}
+		largest = max(largest, limit)
+	}
+	if largest == 0 {
+		return 0
+	}
+	return int64(base64.StdEncoding.EncodedLen(int(largest))) + 4096
+}
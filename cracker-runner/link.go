@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/tetratelabs/wazero"
+)
+
+// modules provided by Extism and the runtime, any function
+var runtimeModules = []string{"extism:host/env", "wasi_snapshot_preview1"}
+
+// host functions of the runner (extism:host/user)
+var hostFunctions = []extism.HostFunction{ReadChunk, Emit, GetRequestID, ConfigGet}
+
+// LinkFlag is a repeatable name=path flag: a module linked to the plugin,
+// which imports its functions from the module name
+type LinkFlag []extism.WasmFile
+
+func (l *LinkFlag) String() string {
+	var links []string
+	for _, link := range *l {
+		links = append(links, link.Name+"="+link.Path)
+	}
+	return strings.Join(links, ",")
+}
+
+func (l *LinkFlag) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || name == "" || path == "" {
+		return fmt.Errorf("expected name=path, got %q", value)
+	}
+	if name == "main" || slices.Contains(runtimeModules, name) || name == "extism:host/user" {
+		return fmt.Errorf("%s is a reserved module name", name)
+	}
+	*l = append(*l, extism.WasmFile{Name: name, Path: path})
+	return nil
+}
+
+// CheckImports returns an error listing the imports of the main module
+// (the one named main, or the last one) which no module of the manifest,
+// no host function and no runtime module provides
+func CheckImports(ctx context.Context, manifest extism.Manifest) error {
+	// the interpreter doesn't compile the code: only the imports and exports matter
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfigInterpreter())
+	defer runtime.Close(ctx)
+
+	// functions by module: Extism links the functions of the modules by
+	// their debug name (name section), which may differ from the export name
+	exports := map[string][]string{}
+	exported := map[string][]string{}
+	for _, function := range hostFunctions {
+		exports[function.Namespace] = append(exports[function.Namespace], function.Name)
+	}
+	var main wazero.CompiledModule
+	for i, wasm := range manifest.Wasm {
+		data, err := wasm.ToWasmData(ctx)
+		if err != nil {
+			return err
+		}
+		compiled, err := runtime.CompileModule(ctx, data.Data)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", data.Name, err)
+		}
+		if data.Name == "main" || (main == nil && (data.Name == "" || i == len(manifest.Wasm)-1)) {
+			main = compiled
+			continue
+		}
+		exports[data.Name] = []string{}
+		for name, definition := range compiled.ExportedFunctions() {
+			exports[data.Name] = append(exports[data.Name], definition.Name())
+			exported[data.Name] = append(exported[data.Name], name)
+		}
+	}
+
+	var mismatches []string
+	for _, function := range main.ImportedFunctions() {
+		module, name, _ := function.Import()
+		if slices.Contains(runtimeModules, module) {
+			continue
+		}
+		functions, ok := exports[module]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("%s.%s: no module %s (-link %s=path)", module, name, module, module))
+		case slices.Contains(functions, name):
+		case slices.Contains(exported[module], name):
+			mismatches = append(mismatches, fmt.Sprintf("%s.%s: exported by %s, but its debug name (name section) is different", module, name, module))
+		default:
+			mismatches = append(mismatches, fmt.Sprintf("%s.%s: not exported by %s", module, name, module))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("unresolved imports of the main module:\n  %s", strings.Join(mismatches, "\n  "))
+	}
+	return nil
+}
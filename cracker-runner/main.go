@@ -1,129 +1,728 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	extism "github.com/extism/go-sdk"
 	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/sys"
+	"google.golang.org/grpc"
 )
 
+// log the stdout of the plugin calls (-log-plugin-stdout)
+var logPluginStdout bool
+
+// function called once on each new instance, before the calls (-init-function)
+var initFunction string
+
+// a new instance of the plugin for each call, closed afterwards (-fresh-instance)
+var freshInstance bool
+
 // store all your plugins in a normal Go hash map, protected by a Mutex
-// (reproduce something like the node.js event loop)
-// to avoid "memory collision 💥"
 var m sync.Mutex
-var plugins = make(map[string]*extism.Plugin)
+var plugins = make(map[string]*instance)
 
-func StorePlugin(plugin *extism.Plugin) {
-	plugins["code"] = plugin
+// the open instances (the stored ones and the replaced ones
+// with in-flight calls), protected by m
+var instances []*instance
+var loaded int
+
+// number of the fresh instances (-fresh-instance, -pool-max), each its own
+var freshCreated atomic.Int64
+
+// instance is a loaded plugin; once replaced (reload), it is closed
+// after its last in-flight call
+type instance struct {
+	plugin *extism.Plugin
+	// compilation of the plugin, shared by its fresh instances (-fresh-instance)
+	compiled     *extism.CompiledPlugin
+	moduleConfig wazero.ModuleConfig
+	name         string
+	// number of the instance, incremented at each load (at each creation
+	// for the fresh ones)
+	index  int
+	memory *Memory
+	// one call at a time on an instance
+	// (reproduce something like the node.js event loop)
+	// to avoid "memory collision 💥"
+	mutex sync.Mutex
+	// in-flight calls and replaced flag, protected by m
+	refs     int
+	replaced bool
+	// stdout of the plugin during the current call (-log-plugin-stdout)
+	stdout *bytes.Buffer
+	// the module was closed by a call, protected by mutex
+	closed bool
+	// the current call, for the guest logs (-plugin-log-level), protected by mutex
+	guestCall guestCall
+	// custom sections of the main module (GET /functions/{name}/meta)
+	sections []CustomSection
+	// hash and modification time of the main module (GET /admin/config)
+	module ModuleInfo
+	// closed after the last call of the replaced instance (-reload-policy), protected by m
+	drained chan struct{}
+	// warm instances of the compilation (-pool-max)
+	pool *Pool
 }
 
-func GetPlugin() (extism.Plugin, error) {
-	if plugin, ok := plugins["code"]; ok {
-		return *plugin, nil
+// StorePlugin stores the loaded plugin, the replaced one is closed after its last call
+func StorePlugin(inst *instance) {
+	m.Lock()
+	defer m.Unlock()
+	storePlugin(inst)
+}
+
+// storePlugin stores the plugin (m is locked)
+func storePlugin(inst *instance) {
+	if previous, ok := plugins["code"]; ok {
+		previous.replaced = true
+		openSwap(previous)
+		previous.closeIfIdle()
+	}
+	inst.index = loaded
+	loaded++
+	plugins["code"] = inst
+	instances = append(instances, inst)
+}
+
+// GetPlugin returns the stored plugin (not a copy: the plugin keeps
+// the state of its guest runtime between the calls)
+func GetPlugin() (*extism.Plugin, error) {
+	m.Lock()
+	defer m.Unlock()
+	if inst, ok := plugins["code"]; ok {
+		return inst.plugin, nil
 	} else {
-		return extism.Plugin{}, errors.New("🔴 no plugin")
+		return nil, ErrNoPlugin
 	}
 }
 
-func GetBytesBody(request *http.Request) []byte {
-	body := make([]byte, request.ContentLength)
-	request.Body.Read(body)
-	return body
+// acquire returns the current instance, which stays open until release
+func acquire() (*instance, error) {
+	m.Lock()
+	defer m.Unlock()
+	inst, ok := plugins["code"]
+	if !ok {
+		return nil, ErrNoPlugin
+	}
+	inst.refs++
+	return inst, nil
 }
 
-func main() {
+// lockInstance returns the current instance, acquired and locked
+func lockInstance() (*instance, error) {
+	for {
+		inst, err := acquire()
+		if err != nil {
+			return nil, err
+		}
+		inst.mutex.Lock()
+		if !inst.closed {
+			return inst, nil
+		}
+		// closed by the previous call, its replacement is stored
+		inst.mutex.Unlock()
+		inst.release()
+	}
+}
 
-	// test the number of arguments
-	if len(os.Args) < 3 {
-		log.Println("👋 Cracker Runner Demo 🚀")
-		os.Exit(0)
+func (inst *instance) release() {
+	m.Lock()
+	defer m.Unlock()
+	inst.refs--
+	inst.closeIfIdle()
+}
+
+// closeIfIdle closes a replaced instance without in-flight call (m is locked)
+func (inst *instance) closeIfIdle() {
+	if inst.replaced && inst.refs == 0 {
+		closeSwap(inst)
+		if err := inst.close(context.Background()); err != nil {
+			log.Println("🔴 !!! Error when closing the plugin", err)
+		}
+		instances = slices.DeleteFunc(instances, func(open *instance) bool {
+			return open == inst
+		})
+	}
+}
+
+// LoadPlugin loads the plugin of the source
+func LoadPlugin(ctx context.Context, source PluginSource) (*instance, error) {
+	manifest, err := source.Manifest()
+	if err != nil {
+		return nil, err
 	}
 
-	wasmFilePath := os.Args[1:][0]
-	wasmFunctionName := os.Args[1:][1]
+	// the memory tracks the size of the linear memories of the instance
+	inst := &instance{name: "code", memory: &Memory{}}
 
-	//httpPort := os.Args[1:][2]
-	httpPort := "8080" // Default value
-	if len(os.Args) > 3 {
-		httpPort = os.Args[3]
+	// before readWasm replaces the files by their content
+	modules := slices.Clone(manifest.Wasm)
+	wasm, err := readWasm(ctx, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	inst.module = NewModuleInfo(modules, wasm)
+	if inst.sections, err = CustomSections(wasm); err != nil {
+		return nil, err
 	}
 
-	ctx := context.Background()
+	moduleConfig := wazero.NewModuleConfig().WithSysWalltime()
+	if logPluginStdout {
+		inst.stdout = &bytes.Buffer{}
+		moduleConfig = moduleConfig.WithStdout(inst.stdout)
+	}
 
 	config := extism.PluginConfig{
-		ModuleConfig: wazero.NewModuleConfig().WithSysWalltime(),
+		ModuleConfig: moduleConfig,
 		EnableWasi:   true,
 	}
+	// the deadlines of the calls (and the clients leaving a stream) interrupt the plugin
+	if largestTimeout() > 0 || streamNDJSON {
+		config.RuntimeConfig = wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	}
+
+	ctx = experimental.WithMemoryAllocator(ctx, inst.memory)
+	start := time.Now()
+	compiled, err := extism.NewCompiledPlugin(ctx, manifest, config, hostFunctions) // new
+	if err != nil {
+		return nil, err
+	}
+	compiles.Add(1)
+	compileTime.Add(int64(time.Since(start)))
+	plugin, err := compiled.Instance(ctx, extism.PluginInstanceConfig{ModuleConfig: moduleConfig})
+	if err != nil {
+		compiled.Close(ctx)
+		return nil, err
+	}
+	inst.plugin, inst.compiled, inst.moduleConfig = plugin, compiled, moduleConfig
+	plugin.SetLogger(inst.logGuest)
+	ownConfig(plugin)
 
-	manifest := extism.Manifest{
-		Wasm: []extism.Wasm{
-			extism.WasmFile{
-				Path: wasmFilePath},
-		},
-		AllowedHosts: []string{"*"},
-		Config:       map[string]string{},
+	// one-time setup of the instance, before any call
+	if initFunction != "" {
+		start := time.Now()
+		if err := inst.initialize(ctx); err != nil {
+			inst.close(ctx)
+			return nil, err
+		}
+		log.Println("🧰 initialized with", initFunction, "in", time.Since(start).Round(time.Microsecond))
+	}
+	if poolMax > 0 {
+		if inst.pool, err = NewPool(ctx, inst); err != nil {
+			inst.close(ctx)
+			return nil, err
+		}
 	}
+	return inst, nil
+}
 
-	pluginInst, err := extism.NewPlugin(ctx, manifest, config, nil) // new
+// fresh returns a new instance of the compiled plugin, initialized, for a
+// single call (-fresh-instance): nothing leaks from a call to the next
+func (inst *instance) fresh(ctx context.Context) (*instance, error) {
+	call := &instance{name: inst.name, index: int(freshCreated.Add(1)), memory: &Memory{}, sections: inst.sections}
+	// its own memory, not the one of the stored instance
+	ctx = experimental.WithMemoryAllocator(ctx, call.memory)
+	moduleConfig := inst.moduleConfig
+	if logPluginStdout {
+		call.stdout = &bytes.Buffer{}
+		moduleConfig = moduleConfig.WithStdout(call.stdout)
+	}
+	plugin, err := inst.compiled.Instance(ctx, extism.PluginInstanceConfig{ModuleConfig: moduleConfig})
 	if err != nil {
-		log.Println("🔴 !!! Error when loading the plugin", err)
-		os.Exit(1)
+		return nil, err
 	}
+	compiledInstances.Add(1)
+	call.plugin = plugin
+	plugin.SetLogger(call.logGuest)
+	ownConfig(plugin)
+	if initFunction != "" {
+		if err := call.initialize(ctx); err != nil {
+			call.close(ctx)
+			return nil, err
+		}
+	}
+	return call, nil
+}
 
-	StorePlugin(pluginInst)
+// close closes the instance, and its compilation unless it's a fresh instance
+func (inst *instance) close(ctx context.Context) error {
+	if inst.pool != nil {
+		inst.pool.close()
+	}
+	err := inst.plugin.Close(ctx)
+	if inst.compiled != nil {
+		err = errors.Join(err, inst.compiled.Close(ctx))
+	}
+	return err
+}
 
-	mux := http.NewServeMux()
+// initialize calls the -init-function of a new instance
+func (inst *instance) initialize(ctx context.Context) error {
+	if !inst.plugin.FunctionExists(initFunction) {
+		return fmt.Errorf("%w: %s (-init-function)", ErrUnknownFunction, initFunction)
+	}
+	inst.startGuestLogs(ctx, initFunction)
+	_, _, err := inst.plugin.CallWithContext(ctx, initFunction, nil)
+	if inst.stdout != nil {
+		logStdout(ctx, initFunction, inst.stdout)
+		inst.stdout.Reset()
+	}
+	if err != nil {
+		return fmt.Errorf("%s (-init-function): %w", initFunction, err)
+	}
+	return nil
+}
 
-	mux.HandleFunc("POST /", func(response http.ResponseWriter, request *http.Request) {
+var ErrUnknownFunction = errors.New("unknown function")
 
-		params := GetBytesBody(request)
-		// unmarshal the json data
-		//var data map[string]string
+// CallPlugin calls a function of the stored plugin, one call at a time
+// per instance; a call started before a reload ends on the old instance
+// (ctx carries the request id)
+func CallPlugin(ctx context.Context, functionName string, input []byte) ([]byte, error) {
+	if coalesce && idempotent(ctx, functionName) {
+		return coalesceCall(ctx, functionName, input)
+	}
+	return callPlugin(ctx, functionName, input, nil)
+}
 
-		//err := json.Unmarshal(body, &data)
-		//if err != nil {
-		//	response.Write([]byte("😡 Error: " + err.Error()))
-		//}
+func callPlugin(ctx context.Context, functionName string, input []byte, stream *bodyStream) ([]byte, error) {
+	if stream == nil {
+		input = DefaultInput(functionName, input)
+	}
+	// no new call on a swapping plugin (-reload-policy)
+	if err := waitSwap(ctx); err != nil {
+		return nil, err
+	}
+	// fail fast without waiting for an instance of a failing plugin
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+	called := false
+	defer func() {
+		if !called {
+			breaker.Skip()
+		}
+	}()
 
-		//model := data["model"]
-		//systemContent := data["system"]
-		//userContent := data["user"]
-		m.Lock()
+	// a capped function doesn't starve the other ones
+	if err := enterCall(functionName); err != nil {
+		stats.Throttled(functionName)
+		return nil, err
+	}
+	defer leaveCall(functionName)
+
+	var inst *instance
+	var err error
+	if freshInstance {
+		// a new instance of the stored plugin, for this call only
+		stored, err := acquire()
+		if err != nil {
+			return nil, err
+		}
+		defer stored.release()
+		if inst, err = stored.fresh(ctx); err != nil {
+			return nil, err
+		}
+		defer inst.close(context.Background())
+	} else if poolMax > 0 {
+		// a warm instance of the stored plugin, given back after the call
+		stored, err := acquire()
+		if err != nil {
+			return nil, err
+		}
+		defer stored.release()
+		if inst, err = stored.pool.get(ctx); err != nil {
+			return nil, err
+		}
+		defer stored.pool.put(inst)
+	} else {
+		inst, err = lockInstance()
+		if err != nil {
+			return nil, err
+		}
+		defer inst.release()
 		// don't forget to release the lock on the Mutex
-		defer m.Unlock()
+		defer inst.mutex.Unlock()
+	}
 
-		pluginInst, err := GetPlugin()
+	call := startCall(functionName)
+	defer call.end()
 
-		if err != nil {
-			log.Println("🔴 !!! Error when getting the plugin", err)
-			response.Write([]byte("😡 Error: " + err.Error()))
+	if !inst.plugin.FunctionExists(functionName) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFunction, functionName)
+	}
+	if err := CheckInputSize(functionName, int64(len(input))); err != nil {
+		return nil, err
+	}
+	// a streamed body is not buffered (the schema is refused at startup)
+	if stream == nil {
+		if err := CheckInputSchema(functionName, input); err != nil {
+			return nil, err
+		}
+	}
+	// the deadline expired while waiting for the instance
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCallTimeout, err)
+	}
 
+	if inst.stdout != nil {
+		inst.stdout.Reset()
+		defer logStdout(ctx, functionName, inst.stdout)
+	}
+
+	inst.startGuestLogs(ctx, functionName)
+	inst.setMethod(ctx)
+	start := time.Now()
+	rc, out, err := inst.plugin.CallWithContext(ctx, functionName, input)
+	recordTiming(ctx, time.Since(start))
+	called = true
+	if exitErr, closed := moduleClosed(ctx, err); closed {
+		if exitErr.ExitCode() == sys.ExitCodeDeadlineExceeded {
+			err = fmt.Errorf("%w: %s after %s", ErrCallTimeout, functionName, time.Since(start).Round(time.Millisecond))
+		} else if exitErr.ExitCode() == sys.ExitCodeContextCanceled {
+			// the client left the stream (-stream-ndjson)
+			err = fmt.Errorf("%w: %s", ErrCallCanceled, functionName)
+		} else if mapped := exitCodeError(functionName, exitErr.ExitCode(), nil, nil); mapped != nil {
+			// proc_exit: an answer of the plugin, without output
+			err = mapped
+		}
+		if poolMax > 0 {
+			// dropped by the pool
+			inst.closed = true
+		} else if !freshInstance {
+			replaceClosed(inst)
 		}
+	} else if mapped := exitCodeError(functionName, rc, out, err); mapped != nil {
+		if err = CheckOutputSize(functionName, int64(len(out))); err == nil {
+			err = mapped
+		}
+		out = nil
+	} else if err != nil {
+		if logDeniedHosts {
+			logDeniedHost(ctx, inst, functionName, err)
+		}
+		err = pluginError(err)
+	} else if err = CheckOutputSize(functionName, int64(len(out))); err != nil {
+		// a runaway plugin: never write its output
+		out = nil
+	}
+	// the transient failures don't say the plugin is broken
+	switch {
+	case err == nil || isExitCode(err):
+		breaker.Success()
+	case isRetryable(err) || errors.Is(err, ErrCallCanceled):
+		breaker.Skip()
+	default:
+		breaker.Failure()
+	}
+	inputSize := int64(len(input))
+	if stream != nil {
+		inputSize = stream.size
+		if stream.err != nil {
+			err = stream.err
+		}
+	}
+	stats.Call(functionName, inputSize, err)
+	return out, err
+}
 
-		_, out, err := pluginInst.Call(wasmFunctionName, params)
+// logStdout logs the stdout of a call of the plugin, line by line, with the request id
+func logStdout(ctx context.Context, functionName string, stdout *bytes.Buffer) {
+	for line := range strings.Lines(stdout.String()) {
+		log.Printf("🐛 [%s] %s stdout: %s", RequestID(ctx), functionName, strings.TrimRight(line, "\r\n"))
+	}
+}
+
+func main() {
+
+	// cracker-runner bench -wasm plugin.wasm -fn function [flags]
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		bench(os.Args[2:])
+		return
+	}
+
+	// cracker-runner gen-client -wasm plugin.wasm [-fn function] [-package client] [-o client.go]
+	if len(os.Args) > 1 && os.Args[1] == "gen-client" {
+		genClient(os.Args[2:])
+		return
+	}
+
+	// cracker-runner [flags] plugin.wasm function [port]
+	// cracker-runner -manifest manifest.json [flags] function [port]
+	flag.BoolVar(&checkConfig, "check-config", false, "validate the flags, the arguments and the plugin (loaded, not called), report all the problems and exit without serving")
+	manifestPath := flag.String("manifest", "", "Extism manifest (JSON) of the plugin: wasm sources, allowed hosts, config, timeout, memory...")
+	var allowedHosts ListFlag
+	flag.Var(&allowedHosts, "allowed-host", "host the plugin can reach, repeatable, replaces the allowed hosts of the manifest (default: *)")
+	pluginConfig := ConfigFlag{}
+	flag.Var(pluginConfig, "plugin-config", "key=value config of the plugin, repeatable, merged into the config of the manifest")
+	flag.Var(&callConfigKeys, "call-config-key", "config key a client can override for a call with a X-Plugin-Config: key=value header, read by the plugin with config_get, repeatable")
+	flag.Var(&allowedReloadSources, "allowed-reload-source", "directory of wasm files, URL prefix, or inline (base64 modules), a POST /admin/reload body can swap the main module to, repeatable (default: none)")
+	var links LinkFlag
+	flag.Var(&links, "link", "name=path of a module linked to the plugin, which imports its functions from name, repeatable")
+	manifestTimeoutMs := flag.Int64("manifest-timeout-ms", 0, "timeout of the calls enforced by Extism (milliseconds), on top of -call-timeout, replaces the timeout_ms of the manifest (0 = none)")
+	grpcAddr := flag.String("grpc-addr", "", "also serve the gRPC interface on this address, eg: :9090 (disabled by default)")
+	adminAddr := flag.String("admin-addr", "", "serve /health, /readyz, /stats, /admin/* and /debug/pprof/ on this internal address only, eg: 127.0.0.1:9091 (default: on the main port, without pprof; pprof needs the admin secret)")
+	adminDisabled := flag.Bool("admin-disabled", false, "disable all the /admin routes (404), even with an admin secret")
+	adminSecret := flag.String("admin-secret", os.Getenv("ADMIN_SECRET"), "bearer token of the /admin routes, which are disabled without it (default: ADMIN_SECRET)")
+	flag.Int64Var(&maxBodyBytes, "max-body-bytes", maxBodyBytes, "maximum size of the input of a call (0 = unlimited)")
+	flag.Var(maxConcurrent, "max-concurrent", "maximum concurrent calls of a function (running or waiting), 429 over it, repeatable, eg: transform=2")
+	flag.Var(inputSchemaPaths, "input-schema", "JSON Schema file validating the input of a function before the call (400 when invalid), repeatable, eg: create_user=user.schema.json")
+	flag.Var(exitCodeMap, "exit-code-map", "code=status of the non-zero exit codes of the plugin answered with the output and this HTTP status, repeatable, eg: 2=400,3=404 (default: a failed call)")
+	flag.Int64Var(&maxOutputBytes, "max-output-bytes", 0, "maximum size of the output of a call, larger outputs answer 500 (0 = unlimited)")
+	flag.Var(maxInputBytes, "max-input-bytes", "maximum input size of a function overriding -max-body-bytes, repeatable, eg: say_hello=1024")
+	inputPrefix := flag.String("input-prefix", "", "bytes prepended to the body before calling the default function (POST /)")
+	outputTrimPrefix := flag.String("output-trim-prefix", "", "prefix removed from the output of the default function (POST /)")
+	streamBody := flag.Bool("stream-body", false, "don't buffer the body of POST /, the default function pulls it with the read_chunk host function")
+	flag.BoolVar(&streamNDJSON, "stream-ndjson", false, "serve POST /stream/{name}: the records sent by the function with the emit host function are streamed as NDJSON lines")
+	flag.DurationVar(&streamWriteTimeout, "stream-write-timeout", streamWriteTimeout, "longest write of a NDJSON record to the client of a stream, the call is aborted after it (a client which stops reading)")
+	basePath := flag.String("base-path", "", "path prefix of all the routes, eg: /cracker (behind a reverse proxy)")
+	keepAlives := flag.Bool("keep-alives", true, "keep the HTTP connections alive between requests (-keep-alives=false closes them after each answer)")
+	maxHeaderBytes := flag.Int("max-header-bytes", http.DefaultMaxHeaderBytes, "maximum size of the request headers (HTTP)")
+	flag.StringVar(&reloadWebhook, "reload-webhook", "", "URL notified (POST, JSON event) of the reloads of the plugin")
+	flag.Var(&acceptContentTypes, "accept-content-types", "content types accepted by POST /, comma separated or repeatable, eg: application/json,text/* (default: all)")
+	emptyResponseStatus := flag.Int("empty-response-status", http.StatusOK, "status of the answers of POST / when the output of the plugin is empty, eg: 204")
+	flag.BoolVar(&logDeniedHosts, "log-denied-hosts", false, "log the outbound requests of the plugin denied by the allowed hosts, with the target host")
+	flag.BoolVar(&methodHeader, "method-header", false, "give the HTTP method of each call to the plugin in its X-HTTP-Method config value, and serve PUT, PATCH and DELETE / like POST /")
+	flag.Var(&pluginLogLevel, "plugin-log-level", "minimum level of the guest logs of the plugin written to the runner logs with the request id: trace, debug, info, warn, error or off")
+	flag.BoolVar(&logPluginStdout, "log-plugin-stdout", false, "log the stdout of the plugin calls (debug) with the request id")
+	flag.Var(responseHeaders, "response-header", "static header of the plugin answers, repeatable, eg: \"Cache-Control: no-store\"")
+	flag.BoolVar(&responseHeaderOverride, "response-header-override", false, "the -response-header headers replace the ones set by the runner (Content-Type, X-Request-Id...)")
+	flag.StringVar(&preFunction, "pre-function", "", "function of the plugin transforming the input of the default function (POST /), its output is the input of the call")
+	flag.StringVar(&postFunction, "post-function", "", "function of the plugin transforming the output of the default function (POST /)")
+	flag.BoolVar(&noEmoji, "no-emoji", false, "no emoji in the logs and the error messages (eg: \"Error: unauthorized\")")
+	errorTemplatePath := flag.String("error-template", "", "text/template file of the plain text error bodies, with {{.Status}}, {{.StatusText}} and {{.Message}}")
+	flag.BoolVar(&serverTiming, "server-timing", false, "add a Server-Timing header (plugin;dur=<ms>), the duration of the plugin calls, to the answers")
+	flag.BoolVar(&checksum, "checksum", false, "add a X-Content-SHA256 header, the hash of the plugin output, to the answers")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "grace period of the in-flight calls at shutdown (SIGINT, SIGTERM)")
+	flag.DurationVar(&callTimeout, "call-timeout", 0, "deadline of the plugin calls, eg: 5s (0 = none)")
+	flag.DurationVar(&maxCallTimeout, "max-call-timeout", 0, "largest deadline a client can ask with the X-Call-Timeout-Ms header (default: -call-timeout)")
+	flag.BoolVar(&coalesce, "coalesce", false, "identical in-flight idempotent calls (same function, input, method and per-call config) share a single plugin call")
+	flag.Var(&idempotentFunctions, "idempotent-function", "function whose calls are idempotent, coalesced with -coalesce whatever their method, repeatable (default: only the GET calls)")
+	flag.IntVar(&poolMin, "pool-min", 0, "warm instances of the compiled plugin created at startup and kept when idle (with -pool-max)")
+	flag.IntVar(&poolMax, "pool-max", 0, "maximum instances of the compiled plugin, created under load, each serving one call at a time (0 = a single shared instance)")
+	flag.DurationVar(&poolIdleTimeout, "pool-idle-timeout", poolIdleTimeout, "idle time after which an instance of the pool over -pool-min is closed")
+	flag.DurationVar(&poolMaxWait, "pool-max-wait", 0, "longest wait of a call for an instance of the pool when -pool-max instances are busy, then 503 (0 = until the deadline of the call, or the client leaves)")
+	flag.BoolVar(&freshInstance, "fresh-instance", false, "call each request on a new instance of the compiled plugin, closed afterwards: no state leaks between the calls, the calls run in parallel")
+	flag.StringVar(&initFunction, "init-function", "", "function called once on each new instance of the plugin, before warmup and readiness, eg: _init")
+	flag.StringVar(&healthFunction, "health-function", "", "function of the plugin called by /readyz (empty input) to declare its readiness, eg: _healthz")
+	smokeInputFlag := flag.String("smoke-input", "", "realistic input (@file to read it from a file) of a call of the default function which must succeed before /readyz answers 200, at startup and after a reload")
+	flag.StringVar(&smokeExpect, "smoke-expect", "", "text the output of the smoke call must contain (default: any output)")
+	flag.StringVar(&healthExpect, "health-expect", healthExpect, "output of the health function when the plugin is ready")
+	flag.DurationVar(&healthTimeout, "health-timeout", healthTimeout, "deadline of the health function call")
+	flag.DurationVar(&healthCacheTTL, "health-cache", healthCacheTTL, "how long the result of the health function is reused by /readyz")
+	flag.Var(&warmupFunctions, "warmup-functions", "functions called at startup before serving, comma separated or repeatable, all for every exported function")
+	flag.Var(warmupInputs, "warmup-input", "sample input of a warmup call, repeatable, eg: say_hello=Bob or say_hello=@payload.json")
+	flag.Var(defaultInputs, "default-input", "input of the calls of a function with an empty input (eg: no body), repeatable, eg: ping=pong or ping=@ping.json")
+	flag.IntVar(&breaker.Threshold, "breaker-failures", 0, "consecutive plugin failures opening the circuit breaker, which answers 503 during the cool-down (0 = disabled)")
+	flag.DurationVar(&breaker.Cooldown, "breaker-cooldown", breaker.Cooldown, "cool-down of the open circuit breaker before a probe call")
+	flag.StringVar(&reloadPolicy, "reload-policy", "", "new calls while the replaced plugin finishes its calls after a reload: queue (wait, at most -reload-queue-timeout) or reject (503), default: run them on the new plugin")
+	flag.DurationVar(&reloadQueueTimeout, "reload-queue-timeout", reloadQueueTimeout, "longest wait of a queued call during a reload (-reload-policy queue)")
+	flag.DurationVar(&retryAfter, "retry-after", retryAfter, "Retry-After of the 503 answers in maintenance mode")
+	flag.Parse()
+
+	if noEmoji {
+		log.SetOutput(emojiWriter{os.Stderr})
+	}
+	// the level is global to the Extism runtime
+	extism.SetLogLevel(extism.LogLevel(pluginLogLevel))
+	// all the problems of the config are reported together
+	var problems ConfigErrors
+	if *errorTemplatePath != "" {
+		var err error
+		if errorTemplate, err = LoadErrorTemplate(*errorTemplatePath); err != nil {
+			problems.Add(fmt.Errorf("-error-template: %w", err))
+		}
+	}
+
+	problems.Add(CheckReloadPolicy(reloadPolicy))
+
+	if *emptyResponseStatus < 200 || *emptyResponseStatus > 299 {
+		problems.Add(fmt.Errorf("-empty-response-status must be a 2xx status, got %d", *emptyResponseStatus))
+	}
+
+	if len(inputSchemaPaths) > 0 {
+		var err error
+		if inputSchemas, err = LoadInputSchemas(inputSchemaPaths); err != nil {
+			problems.Add(fmt.Errorf("-input-schema: %w", err))
+		}
+	}
+
+	problems.Add(CheckPool())
+	problems.Add(CheckAllowedHosts(allowedHosts))
+
+	if preFunction != "" && *streamBody {
+		problems.Add(errors.New("-pre-function can't transform a streamed body (-stream-body)"))
+	}
+
+	args := flag.Args()
+	source := PluginSource{
+		ManifestPath: *manifestPath,
+		AllowedHosts: allowedHosts,
+		Config:       pluginConfig,
+		Timeout:      time.Duration(*manifestTimeoutMs) * time.Millisecond,
+		Links:        links,
+	}
+	// the manifest replaces the wasm file argument
+	if source.ManifestPath == "" {
+		if len(args) > 0 {
+			source.WasmFilePath = args[0]
+		}
+		args = args[min(1, len(args)):]
+	}
+
+	// test the number of arguments
+	if len(args) < 1 && !checkConfig {
+		log.Println("👋 Cracker Runner Demo 🚀")
+		os.Exit(0)
+	}
 
+	wasmFunctionName := ""
+	if len(args) > 0 {
+		wasmFunctionName = args[0]
+	} else {
+		problems.Add(errors.New("missing the function argument"))
+	}
+
+	if _, ok := inputSchemas[wasmFunctionName]; ok && *streamBody {
+		problems.Add(fmt.Errorf("-input-schema can't validate a streamed body (-stream-body) of %s", wasmFunctionName))
+	}
+	if _, ok := defaultInputs[wasmFunctionName]; ok && *streamBody {
+		problems.Add(fmt.Errorf("-default-input can't replace a streamed body (-stream-body) of %s", wasmFunctionName))
+	}
+
+	if *smokeInputFlag != "" {
+		input, err := LoadSmokeInput(*smokeInputFlag)
 		if err != nil {
-			fmt.Println(err)
-			response.Write([]byte("😡 Error: " + err.Error()))
+			problems.Add(fmt.Errorf("-smoke-input: %w", err))
+		}
+		// the input of the default function route
+		smokeInput, smokeFunction = slices.Concat([]byte(*inputPrefix), input), wasmFunctionName
+	}
+
+	//httpPort := os.Args[1:][2]
+	httpPort := "8080" // Default value
+	if len(args) > 1 {
+		httpPort = args[1]
+	}
+	problems.Add(CheckPort(httpPort))
+	if *grpcAddr != "" {
+		problems.Add(CheckAddr("-grpc-addr", *grpcAddr, httpPort))
+	}
+	if *adminAddr != "" {
+		problems.Add(CheckAddr("-admin-addr", *adminAddr, httpPort))
+	}
 
-		} else {
-			//c.Status(http.StatusOK)
-			response.Write(out)
+	ctx := context.Background()
 
-			//return c.SendString(string(out))
+	// a clear error for the imports of the plugin that nothing provides
+	sourceErr := CheckSource(source)
+	problems.Add(sourceErr)
+	var manifest extism.Manifest
+	var err error
+	if sourceErr == nil {
+		if manifest, err = source.Manifest(); err == nil {
+			// the flags replace the allowed hosts of the manifest
+			if len(allowedHosts) == 0 {
+				problems.Add(CheckAllowedHosts(manifest.AllowedHosts))
+			}
+			err = CheckImports(ctx, manifest)
 		}
+		if err != nil {
+			problems.Add(fmt.Errorf("linking the plugin: %w", err))
+		}
+	}
+	// the plugin is only loaded with a valid config
+	problems.Exit()
+
+	pluginSource = source
+	pluginInst, err := LoadPlugin(ctx, source)
+	if err != nil {
+		log.Println("🔴 !!! Error when loading the plugin", err)
+		os.Exit(1)
+	}
+
+	if err := CheckPipeline(pluginInst); err != nil {
+		log.Println("🔴 !!! Error when loading the plugin", err)
+		os.Exit(1)
+	}
+
+	if checkConfig {
+		pluginInst.close(ctx)
+		log.Println("✅ config of", source, "is valid")
+		return
+	}
+
+	if err := Warmup(ctx, pluginInst, WarmupFunctions(pluginInst)); err != nil {
+		log.Println("🔴 !!! Error when warming the plugin", err)
+		os.Exit(1)
+	}
 
+	StorePlugin(pluginInst)
+	// not ready before the smoke call passed (-smoke-input)
+	SmokeCheck()
+
+	mux, adminMux := NewMux(Routes{
+		Function:            wasmFunctionName,
+		InputPrefix:         *inputPrefix,
+		OutputTrimPrefix:    *outputTrimPrefix,
+		StreamBody:          *streamBody,
+		EmptyResponseStatus: *emptyResponseStatus,
+		AdminMux:            *adminAddr != "",
+		AdminDisabled:       *adminDisabled,
+		AdminSecret:         *adminSecret,
 	})
 
-	var errListening error
-	log.Println("🌍 http server is listening on: " + httpPort)
-	errListening = http.ListenAndServe(":"+httpPort, mux)
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		grpcServer = NewGRPCServer()
+		go func() {
+			if err := ServeGRPC(grpcServer, *grpcAddr); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	server := &http.Server{Addr: ":" + httpPort, Handler: WithRequestID(WithServerTiming(WithBasePath(CleanBasePath(*basePath), mux))), MaxHeaderBytes: *maxHeaderBytes}
+	server.SetKeepAlivesEnabled(*keepAlives)
+	go func() {
+		log.Println("🌍 http server is listening on: " + httpPort + CleanBasePath(*basePath))
+		if accepted := AcceptedContentTypes(); len(accepted) > 0 {
+			log.Println("📥 accepted content types:", strings.Join(accepted, ", "))
+		}
+		if errListening := server.ListenAndServe(); errListening != http.ErrServerClosed {
+			log.Fatal(errListening)
+		}
+	}()
+
+	var adminServer *http.Server
+	if *adminAddr != "" {
+		adminServer = &http.Server{Addr: *adminAddr, Handler: WithRequestID(adminMux), MaxHeaderBytes: *maxHeaderBytes}
+		go func() {
+			log.Println("🔧 admin server is listening on:", *adminAddr)
+			if errListening := adminServer.ListenAndServe(); errListening != http.ErrServerClosed {
+				log.Fatal(errListening)
+			}
+		}()
+	}
 
-	log.Fatal(errListening)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	Shutdown(server, adminServer, grpcServer, *shutdownTimeout)
 }
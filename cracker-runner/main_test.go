@@ -0,0 +1,640 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cracker-runner/crackertest"
+)
+
+// the plugin of the tests (testdata/plugin), built by TestMain
+var testWasm string
+
+const testSecret = "test-secret"
+
+func TestMain(tests *testing.M) {
+	dir, err := os.MkdirTemp("", "cracker-runner")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testWasm = filepath.Join(dir, "plugin.wasm")
+	build := exec.Command("go", "build", "-buildmode=c-shared", "-o", testWasm, ".")
+	build.Dir = filepath.Join("testdata", "plugin")
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "GOWORK=off")
+	if out, err := build.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "building the test plugin: %v\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := tests.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// set changes a flag variable until the end of the test
+func set[T any](t *testing.T, variable *T, value T) {
+	previous := *variable
+	*variable = value
+	t.Cleanup(func() { *variable = previous })
+}
+
+// loadPlugin loads and stores the test plugin, removed at the end of the test
+func loadPlugin(t *testing.T) *instance {
+	t.Helper()
+	return loadSource(t, PluginSource{WasmFilePath: testWasm})
+}
+
+// loadSource loads and stores the plugin of the source, removed at the end of the test
+func loadSource(t *testing.T, source PluginSource) *instance {
+	t.Helper()
+	inst, err := LoadPlugin(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setSource(source)
+	StorePlugin(inst)
+	t.Cleanup(unloadPlugin)
+	return inst
+}
+
+// unloadPlugin removes the stored plugin, closed after its last call
+func unloadPlugin() {
+	m.Lock()
+	defer m.Unlock()
+	if inst, ok := plugins["code"]; ok {
+		delete(plugins, "code")
+		inst.replaced = true
+		inst.closeIfIdle()
+	}
+}
+
+// serve serves the routes of the default function, with the admin routes
+func serve(t *testing.T, function string) *crackertest.Server {
+	mux, _ := NewMux(Routes{Function: function, EmptyResponseStatus: http.StatusOK, AdminSecret: testSecret})
+	return crackertest.Serve(t, mux)
+}
+
+// reload reloads the plugin (POST /admin/reload)
+func reload(t *testing.T, server *crackertest.Server) *crackertest.Response {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/admin/reload", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+testSecret)
+	return server.Do(t, request)
+}
+
+// post calls the default function from any goroutine, and returns the
+// status and the body of the answer
+func post(server *crackertest.Server, input string) (int, string, error) {
+	response, err := server.Client.Post(server.URL+"/", "text/plain", strings.NewReader(input))
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	return response.StatusCode, string(body), err
+}
+
+// blockingServer returns the URL of a server answering "released" once
+// release is called (at the end of the test at the latest): a slow call
+// of the fetch function
+func blockingServer(t *testing.T) (string, func()) {
+	released := make(chan struct{})
+	var once sync.Once
+	release := func() { once.Do(func() { close(released) }) }
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		<-released
+		response.Write([]byte("released"))
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(release)
+	return server.URL, release
+}
+
+// slowCall starts a call of the fetch function (the default one of the
+// server) on the instance, which lasts until release; the result is the
+// status, the body and the error of the answer
+func slowCall(t *testing.T, server *crackertest.Server, inst *instance) (func(), <-chan string) {
+	t.Helper()
+	url, release := blockingServer(t)
+	result := make(chan string, 1)
+	go func() {
+		status, body, err := post(server, url)
+		result <- fmt.Sprint(status, " ", body, " ", err)
+	}()
+	waitCalls(t, inst, 1)
+	return release, result
+}
+
+// waitCalls waits for n in-flight calls on the instance
+func waitCalls(t *testing.T, inst *instance, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		m.Lock()
+		refs := inst.refs
+		m.Unlock()
+		if refs >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d in-flight calls, want %d", refs, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// isOpen returns true until the instance is closed
+func isOpen(inst *instance) bool {
+	m.Lock()
+	defer m.Unlock()
+	return slices.Contains(instances, inst)
+}
+
+func TestCallPlugin(t *testing.T) {
+	loadPlugin(t)
+	server := serve(t, "say_hello")
+
+	server.Post(t, []byte("Bob")).AssertStatus(t, http.StatusOK).AssertBody(t, "hello Bob")
+	server.Invoke(t, "say_hello", []byte("Jane")).AssertStatus(t, http.StatusOK).AssertBody(t, "hello Jane")
+	server.Invoke(t, "nope", nil).AssertStatus(t, http.StatusNotFound).AssertCode(t, "unknown_function")
+}
+
+func TestNoPlugin(t *testing.T) {
+	// no plugin stored: the load failed, or the reload of a closed one
+	unloadPlugin()
+	server := serve(t, "say_hello")
+
+	server.Post(t, []byte("Bob")).AssertStatus(t, http.StatusServiceUnavailable).AssertCode(t, CodeNoPlugin)
+	server.Invoke(t, "say_hello", nil).AssertStatus(t, http.StatusServiceUnavailable).AssertCode(t, CodeNoPlugin)
+}
+
+func TestReloadDuringCall(t *testing.T) {
+	replaced := loadPlugin(t)
+	server := serve(t, "fetch")
+	release, slow := slowCall(t, server, replaced)
+	// the slow call ends before the server waits for it (cleanup)
+	defer release()
+
+	reload(t, server).AssertStatus(t, http.StatusOK)
+	// the new calls go to the new plugin while the slow one holds the replaced one
+	server.Invoke(t, "say_hello", []byte("Bob")).AssertStatus(t, http.StatusOK).AssertBody(t, "hello Bob")
+	if !isOpen(replaced) {
+		t.Fatal("the replaced plugin is closed during its call")
+	}
+
+	release()
+	if result := <-slow; result != "200 released <nil>" {
+		t.Fatalf("slow call: got %q, want 200 released", result)
+	}
+	if isOpen(replaced) {
+		t.Error("the replaced plugin is still open after its last call")
+	}
+}
+
+func TestReloadUnderLoad(t *testing.T) {
+	loadPlugin(t)
+	server := serve(t, "say_hello")
+
+	done := make(chan struct{})
+	var calls atomic.Int64
+	failures := make(chan string, 100)
+	var workers sync.WaitGroup
+	for worker := range 8 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			input := fmt.Sprint("worker ", worker)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				status, body, err := post(server, input)
+				if err != nil || status != http.StatusOK || body != "hello "+input {
+					failures <- fmt.Sprint(status, " ", body, " ", err)
+					return
+				}
+				calls.Add(1)
+			}
+		}()
+	}
+
+	for range 5 {
+		before := calls.Load()
+		reload(t, server).AssertStatus(t, http.StatusOK)
+		if calls.Load() == before {
+			t.Error("no call during the reload")
+		}
+	}
+	// the load of the README: 8 clients, 3200 calls
+	deadline := time.Now().Add(time.Minute)
+	for calls.Load() < 3200 && len(failures) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(done)
+	workers.Wait()
+	close(failures)
+	for failure := range failures {
+		t.Error("failed call across a reload:", failure)
+	}
+	if n := calls.Load(); n < 3200 {
+		t.Errorf("%d calls, want 3200", n)
+	}
+}
+
+func TestReloadPolicyReject(t *testing.T) {
+	set(t, &reloadPolicy, "reject")
+	replaced := loadPlugin(t)
+	server := serve(t, "fetch")
+	release, slow := slowCall(t, server, replaced)
+	defer release()
+
+	reload(t, server).AssertStatus(t, http.StatusOK)
+	// the replaced plugin is draining
+	server.Invoke(t, "say_hello", []byte("Bob")).AssertStatus(t, http.StatusServiceUnavailable).AssertCode(t, CodeReloading)
+
+	release()
+	<-slow
+	server.Invoke(t, "say_hello", []byte("Bob")).AssertStatus(t, http.StatusOK).AssertBody(t, "hello Bob")
+}
+
+func TestReloadPolicyQueue(t *testing.T) {
+	set(t, &reloadPolicy, "queue")
+	replaced := loadPlugin(t)
+	server := serve(t, "fetch")
+	release, slow := slowCall(t, server, replaced)
+	defer release()
+
+	reload(t, server).AssertStatus(t, http.StatusOK)
+	// a fast call
+	url, answer := blockingServer(t)
+	answer()
+	queued := make(chan string, 1)
+	go func() {
+		status, body, err := post(server, url)
+		queued <- fmt.Sprint(status, " ", body, " ", err)
+	}()
+	select {
+	case result := <-queued:
+		t.Fatalf("the call didn't wait for the replaced plugin to drain: %s", result)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	release()
+	<-slow
+	if result := <-queued; result != "200 released <nil>" {
+		t.Fatalf("queued call: got %q, want 200 released", result)
+	}
+}
+
+func TestReloadPolicyQueueTimeout(t *testing.T) {
+	set(t, &reloadPolicy, "queue")
+	set(t, &reloadQueueTimeout, 100*time.Millisecond)
+	replaced := loadPlugin(t)
+	server := serve(t, "fetch")
+	release, _ := slowCall(t, server, replaced)
+	defer release()
+
+	reload(t, server).AssertStatus(t, http.StatusOK)
+	server.Invoke(t, "say_hello", []byte("Bob")).AssertStatus(t, http.StatusServiceUnavailable).AssertCode(t, CodeReloading)
+}
+
+func TestBinaryOutput(t *testing.T) {
+	loadPlugin(t)
+	server := serve(t, "png")
+
+	want, err := callPlugin(context.Background(), "png", nil, nil)
+	if err != nil || !bytes.HasPrefix(want, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Fatalf("not a PNG: %x (%v)", want, err)
+	}
+	response := server.Post(t, nil).AssertStatus(t, http.StatusOK)
+	if !bytes.Equal(response.Body, want) {
+		t.Errorf("body: got %x, want the PNG %x", response.Body, want)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("Content-Type: got %q, want image/png", contentType)
+	}
+	if length := response.Header.Get("Content-Length"); length != strconv.Itoa(len(want)) {
+		t.Errorf("Content-Length: got %s, want %d", length, len(want))
+	}
+}
+
+func TestOutputContentTypeHeader(t *testing.T) {
+	set(t, &responseHeaders, HeaderFlag{"Content-Type": {"application/vnd.example"}})
+	loadPlugin(t)
+	server := serve(t, "png")
+
+	response := server.Post(t, nil).AssertStatus(t, http.StatusOK)
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/vnd.example" {
+		t.Errorf("Content-Type: got %q, want the -response-header one", contentType)
+	}
+}
+
+func TestManifestTimeout(t *testing.T) {
+	// no -call-timeout: the deadline is the one of Extism
+	loadSource(t, PluginSource{WasmFilePath: testWasm, Timeout: 200 * time.Millisecond})
+	server := serve(t, "spin")
+
+	// spinning for a minute
+	server.Post(t, []byte("60000")).AssertStatus(t, http.StatusGatewayTimeout).AssertCode(t, CodeCallTimeout)
+	// the aborted instance is replaced
+	server.Post(t, []byte("10")).AssertStatus(t, http.StatusOK).AssertBody(t, "spun 10")
+}
+
+// instanceStats returns the instances of GET /stats
+func instanceStats(t *testing.T, server *crackertest.Server) []InstanceStats {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/stats", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats struct {
+		Instances []InstanceStats `json:"instances"`
+	}
+	if err := json.Unmarshal(server.Do(t, request).AssertStatus(t, http.StatusOK).Body, &stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats.Instances
+}
+
+func TestPoolMemory(t *testing.T) {
+	set(t, &poolMin, 1)
+	set(t, &poolMax, 2)
+	stored := loadPlugin(t)
+	server := serve(t, "fetch")
+
+	instances := instanceStats(t, server)
+	if len(instances) != 2 || instances[0].Pooled || !instances[1].Pooled {
+		t.Fatalf("instances: got %+v, want the stored one and a warm one of the pool", instances)
+	}
+	// the warm instance doesn't grow the memory of the stored one
+	if instances[0].MemoryPages != instances[1].MemoryPages {
+		t.Errorf("memory pages: got %d for the stored instance, %d for the warm one, want the same", instances[0].MemoryPages, instances[1].MemoryPages)
+	}
+
+	// the warm instance is busy: a call creates another one
+	release, slow := slowCall(t, server, stored)
+	defer release()
+	server.Invoke(t, "say_hello", []byte("Bob")).AssertStatus(t, http.StatusOK)
+	instances = instanceStats(t, server)
+	if len(instances) != 3 || !instances[2].Pooled || instances[2].MemoryPages == 0 {
+		t.Errorf("instances: got %+v, want the memory of the created instance of the pool", instances)
+	} else if instances[1].Instance == instances[2].Instance {
+		t.Errorf("instances: got %+v, want a number per instance of the pool", instances)
+	}
+	release()
+	<-slow
+}
+
+func TestPoolWarmup(t *testing.T) {
+	set(t, &poolMin, 2)
+	set(t, &poolMax, 2)
+	stored := loadPlugin(t)
+	if err := Warmup(context.Background(), stored, []string{"counter"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// each warm instance of the pool counted the warmup call
+	ctx := context.Background()
+	first, err := stored.pool.get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.pool.put(first)
+	second, err := stored.pool.get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.pool.put(second)
+	for _, inst := range []*instance{first, second} {
+		if _, out, err := inst.plugin.Call("counter", nil); err != nil || string(out) != "2" {
+			t.Errorf("instance %d: got %q %v, want 2 (warmed)", inst.index, out, err)
+		}
+	}
+}
+
+func TestPoolIsolation(t *testing.T) {
+	set(t, &poolMax, 2)
+	stored := loadPlugin(t)
+	ctx := context.Background()
+
+	// two concurrent calls, each on its own instance of the pool
+	first, err := stored.pool.get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.pool.put(first)
+	second, err := stored.pool.get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.pool.put(second)
+
+	counter := func(inst *instance) string {
+		t.Helper()
+		_, out, err := inst.plugin.Call("counter", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	// the global of the plugin is kept by the calls of an instance...
+	counter(first)
+	if count := counter(first); count != "2" {
+		t.Errorf("second call on the first instance: got %s, want 2", count)
+	}
+	// ...and not shared with the other instance
+	if count := counter(second); count != "1" {
+		t.Errorf("first call on the second instance: got %s, want 1 (shared global)", count)
+	}
+}
+
+func TestPoolClientGone(t *testing.T) {
+	// no deadline and no -pool-max-wait: only the client bounds the wait
+	set(t, &poolMax, 1)
+	stored := loadPlugin(t)
+	server := serve(t, "fetch")
+	release, slow := slowCall(t, server, stored)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/", strings.NewReader("http://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Client.Do(request); err == nil {
+		t.Fatal("the queued call answered while the instance is busy")
+	}
+	// the queued call leaves the queue with its client
+	deadline := time.Now().Add(5 * time.Second)
+	for stored.pool.waiting.Load() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the call still waits for an instance after its client left")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	release()
+	<-slow
+}
+
+func TestCompileStats(t *testing.T) {
+	set(t, &poolMin, 2)
+	set(t, &poolMax, 2)
+	before := CurrentCompileStats()
+	loadPlugin(t)
+
+	// a compilation, and the warm instances of the pool from it
+	after := CurrentCompileStats()
+	if compiles, reused := after.Compiles-before.Compiles, after.Reused-before.Reused; compiles != 1 || reused != 2 {
+		t.Errorf("got %d compilations and %d reused, want 1 and 2", compiles, reused)
+	}
+	if after.CompileTimeMs <= before.CompileTimeMs || after.SavedTimeMs == 0 {
+		t.Errorf("compile time: got %+v after %+v", after, before)
+	}
+}
+
+func TestPprofNeedsSecret(t *testing.T) {
+	_, adminMux := NewMux(Routes{Function: "say_hello", EmptyResponseStatus: http.StatusOK, AdminMux: true, AdminSecret: testSecret})
+	admin := crackertest.Serve(t, adminMux)
+	get := func(path, secret string) *crackertest.Response {
+		t.Helper()
+		request, err := http.NewRequest(http.MethodGet, admin.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != "" {
+			request.Header.Set("Authorization", "Bearer "+secret)
+		}
+		return admin.Do(t, request)
+	}
+
+	// the arguments hold the admin secret
+	get("/debug/pprof/cmdline", "").AssertStatus(t, http.StatusUnauthorized)
+	get("/debug/pprof/heap", "").AssertStatus(t, http.StatusUnauthorized)
+	get("/debug/pprof/heap", "nope").AssertStatus(t, http.StatusUnauthorized)
+	get("/debug/pprof/heap", testSecret).AssertStatus(t, http.StatusOK)
+	get("/debug/pprof/cmdline", testSecret).AssertStatus(t, http.StatusNotFound)
+}
+
+func TestStreamClientNotReading(t *testing.T) {
+	set(t, &streamNDJSON, true)
+	set(t, &streamWriteTimeout, 200*time.Millisecond)
+	stored := loadPlugin(t)
+	server := serve(t, "say_hello")
+
+	// a client which stays connected, and never reads the records
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "POST /stream/flood HTTP/1.1\r\nHost: cracker\r\nContent-Length: 0\r\n\r\n")
+	waitCalls(t, stored, 1)
+
+	// the stream is aborted: the single instance serves the other calls
+	done := make(chan string, 1)
+	go func() {
+		status, body, err := post(server, "Bob")
+		done <- fmt.Sprint(status, " ", body, " ", err)
+	}()
+	select {
+	case result := <-done:
+		if result != "200 hello Bob <nil>" {
+			t.Errorf("call after the stream: got %q, want 200 hello Bob", result)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("the stream of a client which doesn't read holds the instance")
+	}
+}
+
+func TestReloadWebhook(t *testing.T) {
+	events := make(chan ReloadEvent, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var event ReloadEvent
+		if err := json.NewDecoder(request.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		events <- event
+	}))
+	defer webhook.Close()
+	set(t, &reloadWebhook, webhook.URL)
+	loadPlugin(t)
+	server := serve(t, "say_hello")
+
+	reload(t, server).AssertStatus(t, http.StatusOK)
+	loaded, err := acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.release()
+	if event := <-events; event.Event != "reload" || event.SHA256 != loaded.module.SHA256 {
+		t.Errorf("got %s %q, want reload %q", event.Event, event.SHA256, loaded.module.SHA256)
+	}
+
+	// the hash of the module still serving
+	setSource(PluginSource{WasmFilePath: filepath.Join(t.TempDir(), "missing.wasm")})
+	reload(t, server).AssertStatus(t, http.StatusInternalServerError)
+	if event := <-events; event.Event != "reload_failed" || event.SHA256 != loaded.module.SHA256 {
+		t.Errorf("got %s %q, want reload_failed %q", event.Event, event.SHA256, loaded.module.SHA256)
+	}
+}
+
+func TestHealthProbeTimeout(t *testing.T) {
+	set(t, &healthFunction, "spin")
+	set(t, &healthTimeout, 100*time.Millisecond)
+	set(t, &healthCacheTTL, 0)
+	set(t, &defaultInputs, InputFlag{"spin": []byte("1000")})
+	// the deadlines close the module (CloseOnContextDone)
+	set(t, &callTimeout, 5*time.Second)
+	stored := loadPlugin(t)
+	server := serve(t, "say_hello")
+	resetHealth()
+	spinCalls := func() int64 {
+		stats.mutex.Lock()
+		defer stats.mutex.Unlock()
+		if spin, ok := stats.Functions["spin"]; ok {
+			return spin.Calls
+		}
+		return 0
+	}
+	before := spinCalls()
+
+	if err := PluginHealth(); err == nil {
+		t.Fatal("a probe past its deadline is healthy")
+	}
+	// the probe ends on the same instance, without a reload
+	server.Post(t, []byte("Bob")).AssertStatus(t, http.StatusOK).AssertBody(t, "hello Bob")
+	current, err := acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.release()
+	if current != stored || !isOpen(stored) {
+		t.Error("the probe past its deadline closed the plugin")
+	}
+	if spinCalls() != before {
+		t.Error("the probe is counted in /stats")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// source of the stored plugin, protected by m
+var pluginSource PluginSource
+
+// currentSource returns the source of the stored plugin
+func currentSource() PluginSource {
+	m.Lock()
+	defer m.Unlock()
+	return pluginSource
+}
+
+// setSource records the source of the stored plugin (a reload to another module)
+func setSource(source PluginSource) {
+	m.Lock()
+	defer m.Unlock()
+	pluginSource = source
+}
+
+// PluginSource builds the manifest of the plugin, again at each reload
+type PluginSource struct {
+	// full Extism manifest (JSON), the wasm file is ignored when set
+	ManifestPath string
+	WasmFilePath string
+	// flags on top of the manifest
+	AllowedHosts []string
+	Config       map[string]string
+	// timeout of the calls enforced by Extism, replaces timeout_ms
+	Timeout time.Duration
+	// modules linked to the plugin (-link), before the modules of the manifest
+	Links []extism.WasmFile
+	// module replacing the main module of the wasm file or of the manifest
+	// (body of POST /admin/reload)
+	Module extism.Wasm
+}
+
+func (source PluginSource) String() string {
+	if source.Module != nil {
+		return describeModule(source.Module)
+	}
+	if source.ManifestPath != "" {
+		return source.ManifestPath
+	}
+	return source.WasmFilePath
+}
+
+// Manifest returns the manifest of the -manifest file (or of the wasm file),
+// the allowed hosts and the timeout of the flags replace the ones of the
+// file, the config of the flags is merged into it and the linked modules are
+// added to its modules
+func (source PluginSource) Manifest() (extism.Manifest, error) {
+	manifest := extism.Manifest{
+		Wasm: []extism.Wasm{
+			extism.WasmFile{
+				Path: source.WasmFilePath},
+		},
+		AllowedHosts: []string{"*"},
+		Config:       map[string]string{},
+	}
+	if source.ManifestPath != "" {
+		data, err := os.ReadFile(source.ManifestPath)
+		if err != nil {
+			return manifest, err
+		}
+		manifest = extism.Manifest{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return manifest, fmt.Errorf("%s: %w", source.ManifestPath, err)
+		}
+		if len(manifest.Wasm) == 0 {
+			return manifest, fmt.Errorf("%s: no wasm source", source.ManifestPath)
+		}
+		if manifest.Config == nil {
+			manifest.Config = map[string]string{}
+		}
+	}
+	if source.Module != nil {
+		main := mainModule(manifest.Wasm)
+		manifest.Wasm[main] = withName(source.Module, wasmName(manifest.Wasm[main]))
+	}
+	if len(source.AllowedHosts) > 0 {
+		manifest.AllowedHosts = source.AllowedHosts
+	}
+	for key, value := range source.Config {
+		manifest.Config[key] = value
+	}
+	if source.Timeout > 0 {
+		manifest.Timeout = uint64(source.Timeout.Milliseconds())
+	}
+	// the main module stays the last one
+	var wasm []extism.Wasm
+	for _, link := range source.Links {
+		wasm = append(wasm, link)
+	}
+	manifest.Wasm = append(wasm, manifest.Wasm...)
+	return manifest, nil
+}
+
+// ListFlag is a repeatable string flag
+type ListFlag []string
+
+func (l *ListFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *ListFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// ConfigFlag is a repeatable key=value flag
+type ConfigFlag map[string]string
+
+func (c ConfigFlag) String() string {
+	var values []string
+	for key, value := range c {
+		values = append(values, key+"="+value)
+	}
+	return strings.Join(values, ",")
+}
+
+func (c ConfigFlag) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	c[key] = v
+	return nil
+}
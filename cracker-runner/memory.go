@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// size of a wasm memory page
+const pageSize = 65536
+
+// Memory backs the linear memories of the modules of an instance
+// (the extism kernel and the plugin) to know their size at any time
+type Memory struct {
+	bytes atomic.Int64
+}
+
+// Pages returns the current number of linear memory pages of the instance
+func (memory *Memory) Pages() int64 {
+	return memory.bytes.Load() / pageSize
+}
+
+func (memory *Memory) Allocate(capacity, maximum uint64) experimental.LinearMemory {
+	return &linearMemory{buffer: make([]byte, 0, capacity), maximum: maximum, memory: memory}
+}
+
+type linearMemory struct {
+	buffer  []byte
+	maximum uint64
+	memory  *Memory
+}
+
+// Reallocate grows the buffer to size bytes, the new bytes are zeroed
+// (the memory never shrinks and make zeroes the capacity)
+func (linear *linearMemory) Reallocate(size uint64) []byte {
+	if size > linear.maximum {
+		return nil
+	}
+	if size > uint64(cap(linear.buffer)) {
+		capacity := min(max(size, 2*uint64(cap(linear.buffer))), linear.maximum)
+		buffer := make([]byte, len(linear.buffer), capacity)
+		copy(buffer, linear.buffer)
+		linear.buffer = buffer
+	}
+	linear.memory.bytes.Add(int64(size) - int64(len(linear.buffer)))
+	linear.buffer = linear.buffer[:size]
+	return linear.buffer
+}
+
+func (linear *linearMemory) Free() {
+	linear.memory.bytes.Add(-int64(len(linear.buffer)))
+	linear.buffer = nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// CustomSection is a named custom section of a wasm module (metadata:
+// version, author, schema...)
+type CustomSection struct {
+	Name string `json:"name"`
+	// the data of the section when it's JSON, base64 encoded otherwise
+	JSON   json.RawMessage `json:"json,omitempty"`
+	Base64 []byte          `json:"base64,omitempty"`
+}
+
+var ErrInvalidWasm = errors.New("invalid wasm module")
+
+// CustomSections returns the custom sections of a wasm binary, without the
+// debug ones (name, .debug_*)
+func CustomSections(wasm []byte) ([]CustomSection, error) {
+	if len(wasm) < 8 || string(wasm[:4]) != "\x00asm" {
+		return nil, ErrInvalidWasm
+	}
+	var sections []CustomSection
+	for rest := wasm[8:]; len(rest) > 0; {
+		id := rest[0]
+		size, n := uleb128(rest[1:])
+		if n == 0 || uint64(len(rest)-1-n) < size {
+			return nil, fmt.Errorf("%w: truncated section", ErrInvalidWasm)
+		}
+		payload := rest[1+n : 1+n+int(size)]
+		rest = rest[1+n+int(size):]
+		if id != 0 {
+			continue
+		}
+		length, n := uleb128(payload)
+		if n == 0 || uint64(len(payload)-n) < length {
+			return nil, fmt.Errorf("%w: truncated custom section name", ErrInvalidWasm)
+		}
+		name, data := string(payload[n:n+int(length)]), payload[n+int(length):]
+		if name == "name" || strings.HasPrefix(name, ".debug") {
+			continue
+		}
+		section := CustomSection{Name: name}
+		if json.Valid(data) {
+			section.JSON = data
+		} else {
+			section.Base64 = data
+		}
+		sections = append(sections, section)
+	}
+	return sections, nil
+}
+
+// uleb128 decodes an unsigned LEB128 integer, n is 0 when it's invalid
+func uleb128(data []byte) (value uint64, n int) {
+	for i, b := range data {
+		if i == 10 {
+			return 0, 0
+		}
+		value |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// readWasm reads the wasm sources of the manifest once (the compilation
+// reuses them) and returns the main module: named main, or the last one
+func readWasm(ctx context.Context, manifest *extism.Manifest) ([]byte, error) {
+	var main []byte
+	for i, wasm := range manifest.Wasm {
+		data, err := wasm.ToWasmData(ctx)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Wasm[i] = data
+		if data.Name == "main" || main == nil && i == len(manifest.Wasm)-1 {
+			main = data.Data
+		}
+	}
+	return main, nil
+}
+
+// MetaHandler serves the custom sections of the module of a function
+// (GET /functions/{name}/meta), or one of them with ?section=name
+func MetaHandler(response http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	if !functionName.MatchString(name) {
+		writeError(response, http.StatusBadRequest, CodeInvalidFunction, "invalid function name: "+name)
+		return
+	}
+	inst, err := acquire()
+	if err != nil {
+		status, code := callStatus(err)
+		writeError(response, status, code, err.Error())
+		return
+	}
+	defer inst.release()
+	if !inst.plugin.FunctionExists(name) {
+		writeError(response, http.StatusNotFound, CodeUnknownFunction, fmt.Sprintf("%s: %s", ErrUnknownFunction, name))
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	wanted := request.URL.Query().Get("section")
+	if wanted == "" {
+		sections := inst.sections
+		if sections == nil {
+			sections = []CustomSection{}
+		}
+		json.NewEncoder(response).Encode(map[string][]CustomSection{"sections": sections})
+		return
+	}
+	for _, section := range inst.sections {
+		if section.Name == wanted {
+			json.NewEncoder(response).Encode(section)
+			return
+		}
+	}
+	writeError(response, http.StatusNotFound, CodeNoSection, "no custom section "+wanted)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"regexp"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// give the HTTP method of each call to the plugin, in its X-HTTP-Method
+// config value, and serve PUT, PATCH and DELETE / too (-method-header)
+var methodHeader bool
+
+// config key of the method of the call
+const methodConfigKey = "X-HTTP-Method"
+
+// the methods of the default function route with -method-header, besides POST
+var extraMethods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type methodKey struct{}
+
+// valid methods of the envelopes
+var httpMethod = regexp.MustCompile(`^[A-Za-z]{1,16}$`)
+
+// WithMethod returns a context carrying the HTTP method of the call
+func WithMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, methodKey{}, strings.ToUpper(method))
+}
+
+// Method returns the HTTP method of the call of the context, empty
+// without request (eg: warmup, gRPC)
+func Method(ctx context.Context) string {
+	method, _ := ctx.Value(methodKey{}).(string)
+	return method
+}
+
+// ownConfig copies the config of a new instance: the instances of a
+// compiled plugin share the config of the manifest, the method is per instance
+func ownConfig(plugin *extism.Plugin) {
+	if !methodHeader {
+		return
+	}
+	config := maps.Clone(plugin.Config)
+	if config == nil {
+		config = map[string]string{}
+	}
+	plugin.Config = config
+}
+
+// setMethod sets the X-HTTP-Method config value of the call (the mutex of the instance is locked)
+func (inst *instance) setMethod(ctx context.Context) {
+	if !methodHeader {
+		return
+	}
+	if method := Method(ctx); method != "" {
+		inst.plugin.Config[methodConfigKey] = method
+	} else {
+		delete(inst.plugin.Config, methodConfigKey)
+	}
+}
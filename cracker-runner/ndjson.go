@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// serve POST /stream/{name}: the records emitted by the function are
+// streamed as NDJSON (-stream-ndjson)
+var streamNDJSON bool
+
+// longest write of a record to the client of a stream (-stream-write-timeout):
+// a client which stops reading can't hold the instance
+var streamWriteTimeout = 10 * time.Second
+
+var ErrCallCanceled = errors.New("call canceled")
+
+// recordStream is the response of a streamed call, written by the plugin
+// with emit while the call runs (the context of the call carries it)
+type recordStream struct {
+	function string
+	response http.ResponseWriter
+	records  int
+	// bytes written, checked against the output limit of the function
+	size int64
+	// the client is gone or the output is too large: the records are dropped
+	err error
+	// aborts the call when a record can't be written
+	cancel context.CancelFunc
+}
+
+type recordStreamKey struct{}
+
+// write writes a record as a NDJSON line and flushes it: a JSON record is
+// compacted on one line, any other record is a JSON string
+func (stream *recordStream) write(record []byte) error {
+	if stream.err != nil {
+		return stream.err
+	}
+	var line bytes.Buffer
+	if json.Compact(&line, record) != nil {
+		line.Reset()
+		encoded, _ := json.Marshal(string(record))
+		line.Write(encoded)
+	}
+	line.WriteByte('\n')
+	if err := CheckOutputSize(stream.function, stream.size+int64(line.Len())); err != nil {
+		stream.err = err
+		return err
+	}
+	if stream.records == 0 {
+		stream.response.Header().Set("Content-Type", "application/x-ndjson")
+		stream.response.WriteHeader(http.StatusOK)
+	}
+	controller := http.NewResponseController(stream.response)
+	controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	_, err := stream.response.Write(line.Bytes())
+	if err == nil {
+		err = controller.Flush()
+	}
+	if err != nil {
+		stream.err = fmt.Errorf("%w: %v", ErrCallCanceled, err)
+		if stream.cancel != nil {
+			stream.cancel()
+		}
+		return stream.err
+	}
+	stream.records++
+	stream.size += int64(line.Len())
+	return nil
+}
+
+// Emit is the emit(record: ptr) -> i64 host function (extism:host/user):
+// it sends a record of the plugin memory to the client of a streamed call
+// (POST /stream/{name}) and returns 0, or 1 when the records are dropped
+// (the client is gone, the output is too large, outside a streamed call):
+// the plugin should stop
+var Emit = extism.NewHostFunctionWithStack(
+	"emit",
+	func(ctx context.Context, plugin *extism.CurrentPlugin, stack []uint64) {
+		stream, ok := ctx.Value(recordStreamKey{}).(*recordStream)
+		if !ok {
+			stack[0] = 1
+			return
+		}
+		record, err := plugin.ReadBytes(stack[0])
+		if err != nil || stream.write(record) != nil {
+			stack[0] = 1
+			return
+		}
+		stack[0] = 0
+	},
+	[]extism.ValueType{extism.ValueTypePTR},
+	[]extism.ValueType{extism.ValueTypeI64},
+)
+
+// StreamHandler calls a generator function with the body as input and
+// streams its records as NDJSON with a chunked response (POST /stream/{name});
+// the client going away cancels the call
+func StreamHandler(response http.ResponseWriter, request *http.Request) {
+	function := request.PathValue("name")
+	if !functionName.MatchString(function) {
+		writeError(response, http.StatusBadRequest, CodeInvalidFunction, "invalid function name: "+function)
+		return
+	}
+	input, err := ReadInput(response, request, function)
+	if err != nil {
+		status, code := callStatus(err)
+		writeError(response, status, code, err.Error())
+		return
+	}
+	ctx, cancel, err := callContext(request)
+	if err != nil {
+		writeError(response, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	defer cancel()
+	ctx, cancelCall := context.WithCancel(ctx)
+	defer cancelCall()
+	stop := context.AfterFunc(request.Context(), cancelCall)
+	defer stop()
+
+	stream := &recordStream{function: function, response: response, cancel: cancelCall}
+	// the deadline of the last record must not outlive the stream
+	defer http.NewResponseController(response).SetWriteDeadline(time.Time{})
+	// a stream is never shared (-coalesce)
+	out, err := callPlugin(context.WithValue(ctx, recordStreamKey{}, stream), function, input, nil)
+	if err == nil && stream.err != nil {
+		err = stream.err
+	}
+	// the output of the call is the last record
+	if err == nil && len(out) > 0 {
+		err = stream.write(out)
+	}
+	if errors.Is(err, ErrCallCanceled) || request.Context().Err() != nil {
+		log.Printf("🟡 %s: the client left the stream after %d records", function, stream.records)
+		return
+	}
+	if err != nil {
+		log.Println("🔴 !!! Error when streaming", function, err)
+		status, code := callStatus(err)
+		if stream.records == 0 {
+			writeError(response, status, code, err.Error())
+			return
+		}
+		// the status is sent: the error is the last line
+		json.NewEncoder(response).Encode(ErrorResponse{Error: InvokeError{Code: code, Message: ErrorMessage(err.Error())}})
+		return
+	}
+	if stream.records == 0 {
+		response.Header().Set("Content-Type", "application/x-ndjson")
+		response.WriteHeader(http.StatusOK)
+	}
+}
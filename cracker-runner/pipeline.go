@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// functions of the plugin transforming the input and the output of the
+// default function (-pre-function, -post-function), disabled when empty
+var preFunction, postFunction string
+
+// StageError is the failure of a stage of the pipeline, the status of
+// the answer is the one of the cause
+type StageError struct {
+	Stage    string
+	Function string
+	Err      error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s stage (%s) failed: %v", e.Stage, e.Function, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// CallPipeline calls the -pre-function, then the function with its output,
+// then the -post-function with the output of the function
+func CallPipeline(ctx context.Context, function string, input []byte) ([]byte, error) {
+	var err error
+	if preFunction != "" {
+		if input, err = CallPlugin(ctx, preFunction, input); err != nil {
+			return nil, &StageError{"pre", preFunction, err}
+		}
+	}
+	out, err := CallPlugin(ctx, function, input)
+	if err != nil {
+		if preFunction == "" && postFunction == "" {
+			return nil, err
+		}
+		return nil, &StageError{"main", function, err}
+	}
+	return PostProcess(ctx, out)
+}
+
+// PostProcess calls the -post-function with the output of the default
+// function (also after a streamed call)
+func PostProcess(ctx context.Context, out []byte) ([]byte, error) {
+	if postFunction == "" {
+		return out, nil
+	}
+	out, err := CallPlugin(ctx, postFunction, out)
+	if err != nil {
+		return nil, &StageError{"post", postFunction, err}
+	}
+	return out, nil
+}
+
+// CheckPipeline returns an error when a stage of the pipeline is not
+// exported by the plugin
+func CheckPipeline(inst *instance) error {
+	for _, function := range []string{preFunction, postFunction} {
+		if function != "" && !inst.plugin.FunctionExists(function) {
+			return fmt.Errorf("%w: %s (-pre-function, -post-function)", ErrUnknownFunction, function)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// kinds of the errors of a plugin, which returns them as a JSON error:
+// {"errorKind":"retryable","message":"the downstream service timed out"}
+const (
+	// transient (eg: a downstream timeout): 503 with a Retry-After
+	ErrorKindRetryable = "retryable"
+	// permanent (eg: a bad input): 400
+	ErrorKindFatal = "fatal"
+)
+
+// PluginError is a failure the plugin classified with an error kind
+type PluginError struct {
+	Kind    string `json:"errorKind"`
+	Message string `json:"message"`
+}
+
+func (e *PluginError) Error() string {
+	return e.Message
+}
+
+// pluginError returns the PluginError of a JSON error of the plugin,
+// or err itself when the plugin didn't classify it
+func pluginError(err error) error {
+	var pluginErr PluginError
+	if json.Unmarshal([]byte(err.Error()), &pluginErr) != nil {
+		return err
+	}
+	if pluginErr.Kind != ErrorKindRetryable && pluginErr.Kind != ErrorKindFatal {
+		return err
+	}
+	return &pluginErr
+}
+
+// isRetryable tells if the plugin classified the error as retryable
+func isRetryable(err error) bool {
+	var pluginErr *PluginError
+	return errors.As(err, &pluginErr) && pluginErr.Kind == ErrorKindRetryable
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// minimum level of the guest logs (extism log_* functions) written to the
+// runner logs (-plugin-log-level), off by default
+var pluginLogLevel = LogLevelFlag(extism.LogLevelOff)
+
+// LogLevelFlag is an Extism log level: trace, debug, info, warn, error or off
+type LogLevelFlag extism.LogLevel
+
+func (l LogLevelFlag) String() string {
+	return strings.ToLower(extism.LogLevel(l).String())
+}
+
+func (l *LogLevelFlag) Set(value string) error {
+	for _, level := range []extism.LogLevel{extism.LogLevelTrace, extism.LogLevelDebug, extism.LogLevelInfo, extism.LogLevelWarn, extism.LogLevelError, extism.LogLevelOff} {
+		if strings.EqualFold(value, level.String()) {
+			*l = LogLevelFlag(level)
+			return nil
+		}
+	}
+	return fmt.Errorf("expected trace, debug, info, warn, error or off, got %q", value)
+}
+
+// guestCall is the call running on an instance, attached to the guest logs
+type guestCall struct {
+	requestID string
+	function  string
+}
+
+// startGuestLogs attaches the call to the guest logs of the instance (its mutex is locked)
+func (inst *instance) startGuestLogs(ctx context.Context, function string) {
+	inst.guestCall = guestCall{RequestID(ctx), function}
+}
+
+// logGuest is the Extism logger of an instance: the guest logs go to the
+// runner logs with the request id and the function of the call
+func (inst *instance) logGuest(level extism.LogLevel, message string) {
+	emoji := "🐛"
+	switch level {
+	case extism.LogLevelInfo:
+		emoji = "📝"
+	case extism.LogLevelWarn:
+		emoji = "⚠️"
+	case extism.LogLevelError:
+		emoji = "🔴"
+	}
+	log.Printf("%s [%s] %s %s: %s", emoji, inst.guestCall.requestID, inst.guestCall.function, level, strings.TrimRight(message, "\r\n"))
+}
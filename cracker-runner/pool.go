@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// warm instances of the compiled plugin (-pool-min, -pool-max): the pool
+// starts with poolMin instances, grows up to poolMax under load and closes
+// the instances idle for poolIdleTimeout, down to poolMin
+var poolMin, poolMax int
+
+var poolIdleTimeout = time.Minute
+
+// longest wait of a call for an instance when poolMax instances are busy
+// (-pool-max-wait), bounded by the deadline of the call; 0 = the deadline
+// (the client leaving ends the wait anyway)
+var poolMaxWait time.Duration
+
+var ErrPoolBusy = errors.New("pool busy")
+
+// instances created and closed by the pools, across the reloads
+var poolCreated, poolDestroyed atomic.Int64
+
+// Pool holds the warm instances of a stored plugin, created lazily from
+// its compilation: a call takes one for itself, then gives it back
+type Pool struct {
+	stored *instance
+	// one token per instance in use, at most poolMax
+	slots chan struct{}
+	mutex sync.Mutex
+	// the most recently used last
+	idle []idleInstance
+	// open instances, idle and in use, protected by mutex
+	size int
+	// the created ones, for /stats, protected by mutex
+	instances []*instance
+	// calls waiting for an instance
+	waiting atomic.Int64
+	stop    chan struct{}
+}
+
+type idleInstance struct {
+	inst  *instance
+	since time.Time
+}
+
+// PoolStats are the gauges and counters of the pool in /stats
+type PoolStats struct {
+	Min  int `json:"min"`
+	Max  int `json:"max"`
+	Size int `json:"size"`
+	Idle int `json:"idle"`
+	// calls waiting for an instance
+	Waiting int64 `json:"waiting"`
+	// instances created and closed since the start
+	Created   int64 `json:"created"`
+	Destroyed int64 `json:"destroyed"`
+}
+
+// CheckPool validates the -pool-min and -pool-max flags
+func CheckPool() error {
+	switch {
+	case poolMax == 0 && poolMin == 0:
+		return nil
+	case poolMin < 0 || poolMax < 1:
+		return errors.New("-pool-max must be at least 1")
+	case poolMin > poolMax:
+		return fmt.Errorf("-pool-min %d is over -pool-max %d", poolMin, poolMax)
+	case poolMaxWait < 0:
+		return errors.New("-pool-max-wait must not be negative")
+	case freshInstance:
+		return errors.New("-fresh-instance doesn't reuse the instances, it can't be used with a pool")
+	}
+	return nil
+}
+
+// NewPool creates the pool of the stored plugin with its poolMin warm instances
+func NewPool(ctx context.Context, stored *instance) (*Pool, error) {
+	pool := &Pool{stored: stored, slots: make(chan struct{}, poolMax), stop: make(chan struct{})}
+	for range poolMin {
+		inst, err := stored.fresh(ctx)
+		if err != nil {
+			pool.close()
+			return nil, err
+		}
+		poolCreated.Add(1)
+		pool.size++
+		pool.instances = append(pool.instances, inst)
+		pool.idle = append(pool.idle, idleInstance{inst: inst, since: time.Now()})
+	}
+	go pool.shrink()
+	return pool, nil
+}
+
+// warmup warms the -pool-min instances, the ones of the first calls
+func (p *Pool) warmup(ctx context.Context, functions []string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, idle := range p.idle {
+		if err := warmInstance(ctx, idle.inst, functions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get returns an idle instance, or a new one under poolMax; it waits for
+// an instance given back when poolMax instances are in use
+func (p *Pool) get(ctx context.Context) (*instance, error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	if last := len(p.idle) - 1; last >= 0 {
+		// the warmest one
+		inst := p.idle[last].inst
+		p.idle = p.idle[:last]
+		p.mutex.Unlock()
+		return inst, nil
+	}
+	p.size++
+	p.mutex.Unlock()
+
+	inst, err := p.stored.fresh(ctx)
+	if err != nil {
+		p.mutex.Lock()
+		p.size--
+		p.mutex.Unlock()
+		<-p.slots
+		return nil, err
+	}
+	poolCreated.Add(1)
+	p.mutex.Lock()
+	p.instances = append(p.instances, inst)
+	p.mutex.Unlock()
+	return inst, nil
+}
+
+// acquire takes a slot, waiting in the queue until the deadline of the
+// call (and -pool-max-wait) when poolMax instances are in use, or until
+// the client is gone
+func (p *Pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if poolMaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, poolMaxWait)
+		defer cancel()
+	}
+	p.waiting.Add(1)
+	defer p.waiting.Add(-1)
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: all the %d instances of the pool are busy", ErrPoolBusy, poolMax)
+	case <-requestDone(ctx):
+		return fmt.Errorf("%w: the client left while waiting for an instance of the pool", ErrCallCanceled)
+	}
+}
+
+// put gives an instance back to the pool, a closed one is dropped
+func (p *Pool) put(inst *instance) {
+	p.mutex.Lock()
+	if inst.closed {
+		p.size--
+		p.forget(inst)
+		poolDestroyed.Add(1)
+	} else {
+		p.idle = append(p.idle, idleInstance{inst: inst, since: time.Now()})
+	}
+	p.mutex.Unlock()
+	<-p.slots
+	if inst.closed {
+		inst.close(context.Background())
+	}
+}
+
+// shrink closes the instances idle for poolIdleTimeout, down to poolMin
+func (p *Pool) shrink() {
+	ticker := time.NewTicker(max(poolIdleTimeout/2, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		var idle []*instance
+		p.mutex.Lock()
+		for len(p.idle) > 0 && p.size > poolMin && time.Since(p.idle[0].since) >= poolIdleTimeout {
+			idle = append(idle, p.idle[0].inst)
+			p.forget(p.idle[0].inst)
+			p.idle = p.idle[1:]
+			p.size--
+		}
+		p.mutex.Unlock()
+		for _, inst := range idle {
+			inst.close(context.Background())
+			poolDestroyed.Add(1)
+		}
+		if len(idle) > 0 {
+			log.Println("🔽 pool shrunk by", len(idle), "idle instances")
+		}
+	}
+}
+
+// close closes the idle instances, when the stored plugin is closed (no
+// instance is in use then)
+func (p *Pool) close() {
+	close(p.stop)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, idle := range p.idle {
+		idle.inst.close(context.Background())
+		p.forget(idle.inst)
+		poolDestroyed.Add(1)
+	}
+	p.size -= len(p.idle)
+	p.idle = nil
+}
+
+// forget removes a closed instance from the created ones (mutex is locked)
+func (p *Pool) forget(inst *instance) {
+	p.instances = slices.DeleteFunc(p.instances, func(open *instance) bool {
+		return open == inst
+	})
+}
+
+// InstanceStats returns the gauges of the instances of the pool
+func (p *Pool) InstanceStats() []InstanceStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var instances []InstanceStats
+	for _, inst := range p.instances {
+		instances = append(instances, InstanceStats{
+			Plugin:      inst.name,
+			Instance:    inst.index,
+			Pooled:      true,
+			MemoryPages: inst.memory.Pages(),
+		})
+	}
+	return instances
+}
+
+// Stats returns the gauges and counters of the pool
+func (p *Pool) Stats() PoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return PoolStats{
+		Min:       poolMin,
+		Max:       poolMax,
+		Size:      p.size,
+		Idle:      len(p.idle),
+		Waiting:   p.waiting.Load(),
+		Created:   poolCreated.Load(),
+		Destroyed: poolDestroyed.Load(),
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// what the new calls do between the swap of a reload and the last call of
+// the replaced instance (-reload-policy): "" runs them on the new instance
+// right away, "queue" waits for the replaced instance to drain (at most
+// reloadQueueTimeout), "reject" answers 503
+var reloadPolicy string
+
+var reloadQueueTimeout = 5 * time.Second
+
+var ErrReloading = errors.New("reload in progress")
+
+// closed when the replaced instance has drained, nil outside of a swap, protected by m
+var swapDrained chan struct{}
+
+// CheckReloadPolicy validates the -reload-policy
+func CheckReloadPolicy(policy string) error {
+	switch policy {
+	case "", "queue", "reject":
+		return nil
+	}
+	return fmt.Errorf("invalid -reload-policy %q: expected queue or reject", policy)
+}
+
+// openSwap starts the swap window of a replaced instance with in-flight
+// calls, with a -reload-policy (m is locked)
+func openSwap(previous *instance) {
+	if reloadPolicy == "" || previous.refs == 0 {
+		return
+	}
+	previous.drained = make(chan struct{})
+	swapDrained = previous.drained
+}
+
+// closeSwap ends the swap window when the replaced instance has drained (m is locked)
+func closeSwap(previous *instance) {
+	if previous.drained == nil {
+		return
+	}
+	close(previous.drained)
+	if swapDrained == previous.drained {
+		swapDrained = nil
+	}
+	previous.drained = nil
+}
+
+// waitSwap applies the -reload-policy to a new call during a swap window
+func waitSwap(ctx context.Context) error {
+	m.Lock()
+	drained := swapDrained
+	m.Unlock()
+	if drained == nil {
+		return nil
+	}
+	if reloadPolicy == "reject" {
+		return fmt.Errorf("%w: the replaced plugin is finishing its calls", ErrReloading)
+	}
+	timer := time.NewTimer(reloadQueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: still draining the replaced plugin after %s", ErrReloading, reloadQueueTimeout)
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", ErrCallTimeout, ctx.Err())
+	}
+}
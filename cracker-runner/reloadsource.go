@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// sources of the modules a reload can swap to (-allowed-reload-source):
+// directories of wasm files, URL prefixes, or "inline" for the base64
+// modules of the body; none by default
+var allowedReloadSources ListFlag
+
+// maximum size of the body of a reload (an inline module)
+const maxReloadBodyBytes = 128 << 20
+
+var ErrSourceNotAllowed = errors.New("reload source not allowed")
+
+// ReloadSource is the optional body of POST /admin/reload: the module
+// replacing the main module of the plugin, one of path, url or wasm
+type ReloadSource struct {
+	Path string `json:"path,omitempty"`
+	URL  string `json:"url,omitempty"`
+	// base64 encoded module
+	Wasm []byte `json:"wasm,omitempty"`
+	// expected hash of the module, checked by Extism
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Module returns the module of the reload source, validated against the
+// -allowed-reload-source policy
+func (reload ReloadSource) Module() (extism.Wasm, error) {
+	count := 0
+	for _, set := range []bool{reload.Path != "", reload.URL != "", len(reload.Wasm) > 0} {
+		if set {
+			count++
+		}
+	}
+	if count != 1 {
+		return nil, errors.New("expected one of path, url or wasm")
+	}
+
+	switch {
+	case reload.Path != "":
+		path, err := filepath.Abs(reload.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, allowed := range allowedReloadSources {
+			if allowed == "inline" || strings.Contains(allowed, "://") {
+				continue
+			}
+			dir, err := filepath.Abs(allowed)
+			if err != nil {
+				continue
+			}
+			if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+				return extism.WasmFile{Path: path, Hash: reload.SHA256}, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSourceNotAllowed, reload.Path)
+	case reload.URL != "":
+		for _, allowed := range allowedReloadSources {
+			if strings.Contains(allowed, "://") && urlAllowed(allowed, reload.URL) {
+				return extism.WasmUrl{Url: reload.URL, Hash: reload.SHA256}, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSourceNotAllowed, reload.URL)
+	}
+	if !slices.Contains(allowedReloadSources, "inline") {
+		return nil, fmt.Errorf("%w: inline module", ErrSourceNotAllowed)
+	}
+	return extism.WasmData{Data: reload.Wasm, Hash: reload.SHA256}, nil
+}
+
+// urlAllowed returns true when the URL is under the allowed URL prefix:
+// the same scheme and host (with the port), and a path in the allowed one
+// (https://registry.example.com/modules allows /modules/v2.wasm, not
+// /modules-v2.wasm or another host starting with registry.example.com)
+func urlAllowed(allowed, target string) bool {
+	prefix, err := url.Parse(allowed)
+	if err != nil {
+		return false
+	}
+	module, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(module.Scheme, prefix.Scheme) || !strings.EqualFold(module.Host, prefix.Host) {
+		return false
+	}
+	dir := strings.TrimSuffix(prefix.Path, "/")
+	file := path.Clean("/" + module.Path)
+	return dir == "" || file == dir || strings.HasPrefix(file, dir+"/")
+}
+
+// mainModule returns the index of the main module: named main, or the last one
+func mainModule(modules []extism.Wasm) int {
+	for i, wasm := range modules {
+		if wasmName(wasm) == "main" {
+			return i
+		}
+	}
+	return len(modules) - 1
+}
+
+func wasmName(wasm extism.Wasm) string {
+	switch wasm := wasm.(type) {
+	case extism.WasmFile:
+		return wasm.Name
+	case extism.WasmUrl:
+		return wasm.Name
+	case extism.WasmData:
+		return wasm.Name
+	}
+	return ""
+}
+
+// withName returns the module with the name of the module it replaces
+func withName(wasm extism.Wasm, name string) extism.Wasm {
+	switch wasm := wasm.(type) {
+	case extism.WasmFile:
+		wasm.Name = name
+		return wasm
+	case extism.WasmUrl:
+		wasm.Name = name
+		return wasm
+	case extism.WasmData:
+		wasm.Name = name
+		return wasm
+	}
+	return wasm
+}
+
+// describeModule names a module in the logs
+func describeModule(wasm extism.Wasm) string {
+	switch wasm := wasm.(type) {
+	case extism.WasmFile:
+		return wasm.Path
+	case extism.WasmUrl:
+		return wasm.Url
+	case extism.WasmData:
+		return fmt.Sprintf("inline module (%d bytes)", len(wasm.Data))
+	}
+	return "module"
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestURLAllowed(t *testing.T) {
+	tests := []struct {
+		allowed, url string
+		want         bool
+	}{
+		{"https://registry.example.com/", "https://registry.example.com/v2.wasm", true},
+		{"https://registry.example.com", "https://registry.example.com/v2.wasm", true},
+		{"https://registry.example.com/modules", "https://registry.example.com/modules/v2.wasm", true},
+		{"https://registry.example.com/modules/", "https://registry.example.com/modules/v2.wasm", true},
+		{"https://registry.example.com:8443/", "https://registry.example.com:8443/v2.wasm", true},
+		{"https://registry.example.com/", "HTTPS://Registry.Example.com/v2.wasm", true},
+		// no host boundary with a prefix of the string
+		{"https://registry.example.com", "https://registry.example.com.evil.net/v2.wasm", false},
+		{"https://registry.example.com", "https://registry.example.com@evil.net/v2.wasm", false},
+		{"https://registry.example.com/", "https://registry.example.com:8443/v2.wasm", false},
+		{"https://registry.example.com/", "http://registry.example.com/v2.wasm", false},
+		// the path is a directory
+		{"https://registry.example.com/modules", "https://registry.example.com/modules-v2.wasm", false},
+		{"https://registry.example.com/modules/", "https://registry.example.com/modules/../secret.wasm", false},
+		{"https://registry.example.com/", "not a url\x7f", false},
+	}
+	for _, test := range tests {
+		if got := urlAllowed(test.allowed, test.url); got != test.want {
+			t.Errorf("urlAllowed(%q, %q) = %v, want %v", test.allowed, test.url, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	extism "github.com/extism/go-sdk"
+)
+
+type requestIDKey struct{}
+
+// accepted ids of the X-Request-Id header (they end up in the logs)
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+// NewRequestID returns a random request id
+func NewRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithRequestID gives an id to each request, the X-Request-Id header of the
+// request or a new one, and sends it back in the X-Request-Id header
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get("X-Request-Id")
+		if !validRequestID.MatchString(id) {
+			id = NewRequestID()
+		}
+		response.Header().Set("X-Request-Id", id)
+		ctx := context.WithValue(request.Context(), requestIDKey{}, id)
+		next.ServeHTTP(response, request.WithContext(ctx))
+	})
+}
+
+// RequestID returns the id of the request of the context
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// GetRequestID is the get_request_id() -> i64 host function (extism:host/user):
+// it copies the request id of the call into the memory of the plugin and
+// returns its offset, or 0 when the call has no request id (eg: warmup)
+var GetRequestID = extism.NewHostFunctionWithStack(
+	"get_request_id",
+	func(ctx context.Context, plugin *extism.CurrentPlugin, stack []uint64) {
+		id := RequestID(ctx)
+		if id == "" {
+			stack[0] = 0
+			return
+		}
+		offset, err := plugin.WriteString(id)
+		if err != nil {
+			stack[0] = 0
+			return
+		}
+		stack[0] = offset
+	},
+	[]extism.ValueType{},
+	[]extism.ValueType{extism.ValueTypePTR},
+)
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// static headers of the plugin answers (-response-header)
+var responseHeaders = HeaderFlag{}
+
+// the static headers replace the ones set by the runner (-response-header-override)
+var responseHeaderOverride bool
+
+// HeaderFlag is a repeatable "Key: Value" flag
+type HeaderFlag http.Header
+
+func (h HeaderFlag) String() string {
+	var headers []string
+	for key, values := range h {
+		for _, value := range values {
+			headers = append(headers, key+": "+value)
+		}
+	}
+	return strings.Join(headers, ", ")
+}
+
+func (h HeaderFlag) Set(value string) error {
+	key, headerValue, ok := strings.Cut(value, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("expected \"Key: Value\", got %q", value)
+	}
+	http.Header(h).Add(key, strings.TrimSpace(headerValue))
+	return nil
+}
+
+// headersWriter adds the static headers before the status line
+type headersWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *headersWriter) WriteHeader(status int) {
+	if !w.written {
+		w.written = true
+		header := w.Header()
+		for key, values := range responseHeaders {
+			// the headers of the runner win (Content-Type, Retry-After, X-Request-Id...)
+			if _, set := header[key]; set && !responseHeaderOverride {
+				continue
+			}
+			// a copy: an Add on the answer must not grow the flag
+			header[key] = slices.Clone(values)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headersWriter) Write(data []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *headersWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WithResponseHeaders adds the -response-header headers to the answers
+func WithResponseHeaders(next http.HandlerFunc) http.HandlerFunc {
+	if len(responseHeaders) == 0 {
+		return next
+	}
+	return func(response http.ResponseWriter, request *http.Request) {
+		next(&headersWriter{ResponseWriter: response}, request)
+	}
+}
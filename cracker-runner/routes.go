@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Routes is the configuration of the HTTP routes of the runner
+type Routes struct {
+	// the default function, called by POST /
+	Function            string
+	InputPrefix         string
+	OutputTrimPrefix    string
+	StreamBody          bool
+	EmptyResponseStatus int
+	// the health, stats and admin routes have their own mux (-admin-addr)
+	AdminMux      bool
+	AdminDisabled bool
+	AdminSecret   string
+}
+
+// NewMux returns the mux of the main port and the one of the health, stats
+// and admin routes, the same without Routes.AdminMux
+func NewMux(routes Routes) (mux, adminMux *http.ServeMux) {
+	mux = http.NewServeMux()
+
+	// prepareInput returns the input of the default function
+	prepareInput := func(response http.ResponseWriter, request *http.Request) ([]byte, error) {
+		params, err := ReadInput(response, request, routes.Function)
+		if err != nil {
+			return nil, err
+		}
+		// an empty body gets the default input, before the prefix
+		return slices.Concat([]byte(routes.InputPrefix), DefaultInput(routes.Function, params)), nil
+	}
+
+	defaultHandler := WithResponseHeaders(Available(AcceptContentTypes(func(response http.ResponseWriter, request *http.Request) {
+
+		ctx, cancel, err := callContext(request)
+		if err != nil {
+			writeError(response, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		defer cancel()
+
+		var out []byte
+		if routes.StreamBody {
+			body := io.MultiReader(strings.NewReader(routes.InputPrefix), LimitBody(response, request, routes.Function))
+			out, err = CallPluginStream(ctx, routes.Function, body)
+			if err == nil {
+				out, err = PostProcess(ctx, out)
+			}
+		} else {
+			var params []byte
+			params, err = prepareInput(response, request)
+			// unmarshal the json data
+			//var data map[string]string
+
+			//err := json.Unmarshal(body, &data)
+			//if err != nil {
+			//	response.Write([]byte("😡 Error: " + err.Error()))
+			//}
+
+			//model := data["model"]
+			//systemContent := data["system"]
+			//userContent := data["user"]
+			if err == nil {
+				out, err = CallPipeline(ctx, routes.Function, params)
+			}
+		}
+
+		if exitErr, ok := asExitCode(err); ok && len(exitErr.Output) > 0 {
+			// the output of a mapped exit code is the body of its status
+			log.Println("🟡", exitErr)
+			SetExitCode(response, exitErr)
+			SetOutputHeaders(response, exitErr.Output)
+			response.WriteHeader(exitErr.Status)
+			response.Write(exitErr.Output)
+
+		} else if err != nil {
+			log.Println("🔴 !!! Error when calling", routes.Function, err)
+			status, code := callStatus(err)
+			SetExitCode(response, err)
+			writeError(response, status, code, err.Error())
+
+		} else {
+			//c.Status(http.StatusOK)
+			out = bytes.TrimPrefix(out, []byte(routes.OutputTrimPrefix))
+			SetChecksum(response, out)
+			SetOutputHeaders(response, out)
+			if len(out) == 0 {
+				response.WriteHeader(routes.EmptyResponseStatus)
+			}
+			response.Write(out)
+
+			//return c.SendString(string(out))
+		}
+
+	})))
+	mux.HandleFunc("POST /", defaultHandler)
+	// REST-ish plugins: the method is in the X-HTTP-Method config value
+	if methodHeader {
+		for _, method := range extraMethods {
+			mux.HandleFunc(method+" /", defaultHandler)
+		}
+	}
+
+	mux.HandleFunc("POST /invoke", WithResponseHeaders(Available(InvokeHandler)))
+	mux.HandleFunc("POST /rpc", WithResponseHeaders(Available(RPCHandler)))
+
+	mux.HandleFunc("GET /functions/{name}/schema", WithResponseHeaders(Available(SchemaHandler)))
+	mux.HandleFunc("GET /functions/{name}/meta", WithResponseHeaders(Available(MetaHandler)))
+	if streamNDJSON {
+		mux.HandleFunc("POST /stream/{name}", WithResponseHeaders(Available(StreamHandler)))
+	}
+
+	// with -admin-addr, the health, stats, admin and pprof routes are only
+	// served by the internal listener
+	adminMux = mux
+	if routes.AdminMux {
+		adminMux = http.NewServeMux()
+		// not routed to the plugin either
+		mux.HandleFunc("POST /admin/", http.NotFound)
+	}
+	adminMux.HandleFunc("GET /health", HealthHandler)
+	adminMux.HandleFunc("GET /readyz", ReadyHandler)
+	adminMux.HandleFunc("GET /stats", StatsHandler)
+	switch {
+	case routes.AdminDisabled:
+		// no remote mutation: not even routed to the plugin
+		adminMux.HandleFunc("POST /admin/", http.NotFound)
+		log.Println("🔒 admin routes disabled")
+	case routes.AdminSecret != "":
+		adminMux.HandleFunc("POST /admin/maintenance", Admin(routes.AdminSecret, MaintenanceHandler))
+		adminMux.HandleFunc("POST /admin/drain", Admin(routes.AdminSecret, DrainHandler))
+		adminMux.HandleFunc("POST /admin/reload", Admin(routes.AdminSecret, ReloadHandler))
+		adminMux.HandleFunc("POST /admin/echo", Admin(routes.AdminSecret, EchoHandler(routes.Function, prepareInput, routes.StreamBody)))
+		adminMux.HandleFunc("GET /admin/config", Admin(routes.AdminSecret, ConfigHandler))
+		if routes.AdminMux {
+			HandlePprof(adminMux, routes.AdminSecret)
+		}
+	}
+
+	return mux, adminMux
+}
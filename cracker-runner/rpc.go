@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	// the call of the plugin failed, the runner code is in data
+	RPCServerError = -32000
+)
+
+// RPCRequest is a JSON-RPC 2.0 request: the method is the function of the
+// plugin, the serialized params are its input
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// no id: a notification, without answer
+	ID json.RawMessage `json:"id,omitempty"`
+}
+
+// RPCResponse is a JSON-RPC 2.0 answer, with a result or an error
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// stable code of the runner (eg: call_timeout)
+	Data string `json:"data,omitempty"`
+}
+
+// RPCHandler serves the JSON-RPC 2.0 requests and batches (POST /rpc),
+// the calls of a batch run one after the other
+func RPCHandler(response http.ResponseWriter, request *http.Request) {
+	body := request.Body
+	if limit := envelopeLimit(); limit > 0 {
+		body = http.MaxBytesReader(response, request.Body, limit)
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			writeRPC(response, rpcError(nil, RPCInvalidRequest, err.Error(), CodeInputTooLarge))
+			return
+		}
+		writeRPC(response, rpcError(nil, RPCParseError, "parse error: "+err.Error(), CodeInvalidRequest))
+		return
+	}
+
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(raw, &batch); err != nil || len(batch) == 0 {
+			writeRPC(response, rpcError(nil, RPCInvalidRequest, "invalid batch", CodeInvalidRequest))
+			return
+		}
+		answers := []*RPCResponse{}
+		for _, item := range batch {
+			if answer := callRPC(request, item); answer != nil {
+				answers = append(answers, answer)
+			}
+		}
+		// only notifications
+		if len(answers) == 0 {
+			response.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeRPC(response, answers)
+		return
+	}
+
+	answer := callRPC(request, raw)
+	if answer == nil {
+		response.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeRPC(response, answer)
+}
+
+// callRPC calls the plugin for a JSON-RPC request, nil for a notification
+func callRPC(request *http.Request, raw json.RawMessage) *RPCResponse {
+	var rpc RPCRequest
+	if err := json.Unmarshal(raw, &rpc); err != nil || rpc.JSONRPC != "2.0" || rpc.Method == "" {
+		return rpcError(nil, RPCInvalidRequest, "invalid JSON-RPC 2.0 request", CodeInvalidRequest)
+	}
+	answer := func(response *RPCResponse) *RPCResponse {
+		if rpc.ID == nil {
+			return nil
+		}
+		return response
+	}
+	if !functionName.MatchString(rpc.Method) {
+		return answer(rpcError(rpc.ID, RPCMethodNotFound, "invalid function name: "+rpc.Method, CodeInvalidFunction))
+	}
+
+	ctx, cancel, err := callContext(request)
+	if err != nil {
+		return answer(rpcError(rpc.ID, RPCInvalidRequest, err.Error(), CodeInvalidRequest))
+	}
+	defer cancel()
+
+	out, err := CallPlugin(ctx, rpc.Method, rpc.Params)
+	if err != nil {
+		log.Println("🔴 !!! Error when calling", rpc.Method, err)
+		_, code := callStatus(err)
+		switch code {
+		case CodeUnknownFunction:
+			return answer(rpcError(rpc.ID, RPCMethodNotFound, err.Error(), code))
+		case CodeInputTooLarge, CodeInputSchema, CodePluginFatal:
+			return answer(rpcError(rpc.ID, RPCInvalidParams, err.Error(), code))
+		}
+		return answer(rpcError(rpc.ID, RPCServerError, err.Error(), code))
+	}
+
+	// a JSON output is the result, any other output a JSON string
+	result := json.RawMessage(out)
+	if !json.Valid(out) {
+		result, _ = json.Marshal(string(out))
+	}
+	return answer(&RPCResponse{JSONRPC: "2.0", Result: result, ID: rpc.ID})
+}
+
+func rpcError(id json.RawMessage, code int, message string, data string) *RPCResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: code, Message: ErrorMessage(message), Data: data}, ID: id}
+}
+
+func writeRPC(response http.ResponseWriter, answer any) {
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(answer)
+}
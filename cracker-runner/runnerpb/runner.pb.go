@@ -0,0 +1,183 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: runnerpb/runner.proto
+
+package runnerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type InvokeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name of the exported function, eg: say_hello
+	Function      string `protobuf:"bytes,1,opt,name=function,proto3" json:"function,omitempty"`
+	Input         []byte `protobuf:"bytes,2,opt,name=input,proto3" json:"input,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InvokeRequest) Reset() {
+	*x = InvokeRequest{}
+	mi := &file_runnerpb_runner_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvokeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvokeRequest) ProtoMessage() {}
+
+func (x *InvokeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_runnerpb_runner_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvokeRequest.ProtoReflect.Descriptor instead.
+func (*InvokeRequest) Descriptor() ([]byte, []int) {
+	return file_runnerpb_runner_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *InvokeRequest) GetFunction() string {
+	if x != nil {
+		return x.Function
+	}
+	return ""
+}
+
+func (x *InvokeRequest) GetInput() []byte {
+	if x != nil {
+		return x.Input
+	}
+	return nil
+}
+
+type InvokeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Output        []byte                 `protobuf:"bytes,1,opt,name=output,proto3" json:"output,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InvokeResponse) Reset() {
+	*x = InvokeResponse{}
+	mi := &file_runnerpb_runner_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvokeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvokeResponse) ProtoMessage() {}
+
+func (x *InvokeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_runnerpb_runner_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvokeResponse.ProtoReflect.Descriptor instead.
+func (*InvokeResponse) Descriptor() ([]byte, []int) {
+	return file_runnerpb_runner_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *InvokeResponse) GetOutput() []byte {
+	if x != nil {
+		return x.Output
+	}
+	return nil
+}
+
+var File_runnerpb_runner_proto protoreflect.FileDescriptor
+
+const file_runnerpb_runner_proto_rawDesc = "" +
+	"\n" +
+	"\x15runnerpb/runner.proto\x12\x11cracker.runner.v1\"A\n" +
+	"\rInvokeRequest\x12\x1a\n" +
+	"\bfunction\x18\x01 \x01(\tR\bfunction\x12\x14\n" +
+	"\x05input\x18\x02 \x01(\fR\x05input\"(\n" +
+	"\x0eInvokeResponse\x12\x16\n" +
+	"\x06output\x18\x01 \x01(\fR\x06output2W\n" +
+	"\x06Runner\x12M\n" +
+	"\x06Invoke\x12 .cracker.runner.v1.InvokeRequest\x1a!.cracker.runner.v1.InvokeResponseB\x19Z\x17cracker-runner/runnerpbb\x06proto3"
+
+var (
+	file_runnerpb_runner_proto_rawDescOnce sync.Once
+	file_runnerpb_runner_proto_rawDescData []byte
+)
+
+func file_runnerpb_runner_proto_rawDescGZIP() []byte {
+	file_runnerpb_runner_proto_rawDescOnce.Do(func() {
+		file_runnerpb_runner_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_runnerpb_runner_proto_rawDesc), len(file_runnerpb_runner_proto_rawDesc)))
+	})
+	return file_runnerpb_runner_proto_rawDescData
+}
+
+var file_runnerpb_runner_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_runnerpb_runner_proto_goTypes = []any{
+	(*InvokeRequest)(nil),  // 0: cracker.runner.v1.InvokeRequest
+	(*InvokeResponse)(nil), // 1: cracker.runner.v1.InvokeResponse
+}
+var file_runnerpb_runner_proto_depIdxs = []int32{
+	0, // 0: cracker.runner.v1.Runner.Invoke:input_type -> cracker.runner.v1.InvokeRequest
+	1, // 1: cracker.runner.v1.Runner.Invoke:output_type -> cracker.runner.v1.InvokeResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_runnerpb_runner_proto_init() }
+func file_runnerpb_runner_proto_init() {
+	if File_runnerpb_runner_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_runnerpb_runner_proto_rawDesc), len(file_runnerpb_runner_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_runnerpb_runner_proto_goTypes,
+		DependencyIndexes: file_runnerpb_runner_proto_depIdxs,
+		MessageInfos:      file_runnerpb_runner_proto_msgTypes,
+	}.Build()
+	File_runnerpb_runner_proto = out.File
+	file_runnerpb_runner_proto_goTypes = nil
+	file_runnerpb_runner_proto_depIdxs = nil
+}
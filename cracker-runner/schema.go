@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// exported function of the self-describing plugins: called with a function
+// name as input, it returns the JSON Schema of the function (empty: no schema)
+const schemaFunction = "_schema"
+
+// SchemaHandler serves the schema of a function of the plugin (GET /functions/{name}/schema)
+func SchemaHandler(response http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	if !functionName.MatchString(name) {
+		writeError(response, http.StatusBadRequest, CodeInvalidFunction, "invalid function name: "+name)
+		return
+	}
+	plugin, err := GetPlugin()
+	if err != nil {
+		status, code := callStatus(err)
+		writeError(response, status, code, err.Error())
+		return
+	}
+	if !plugin.FunctionExists(name) {
+		writeError(response, http.StatusNotFound, CodeUnknownFunction, fmt.Sprintf("%s: %s", ErrUnknownFunction, name))
+		return
+	}
+	if !plugin.FunctionExists(schemaFunction) {
+		writeError(response, http.StatusNotFound, CodeNoSchema, "the plugin has no schema")
+		return
+	}
+
+	ctx, cancel, _ := WithCallTimeout(request.Context(), callTimeout)
+	defer cancel()
+	schema, err := CallPlugin(ctx, schemaFunction, []byte(name))
+	if err != nil {
+		log.Println("🔴 !!! Error when calling", schemaFunction, err)
+		status, code := callStatus(err)
+		writeError(response, status, code, err.Error())
+		return
+	}
+	if len(schema) == 0 {
+		writeError(response, http.StatusNotFound, CodeNoSchema, "no schema for "+name)
+		return
+	}
+	if !json.Valid(schema) {
+		writeError(response, http.StatusInternalServerError, CodeCallFailed, "the schema of "+name+" is not valid JSON")
+		return
+	}
+	response.Header().Set("Content-Type", "application/schema+json")
+	response.Write(schema)
+}
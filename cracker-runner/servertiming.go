@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// add a Server-Timing header with the duration of the plugin calls (-server-timing)
+var serverTiming bool
+
+type timingKey struct{}
+
+// callTiming sums the durations of the plugin calls of a request
+// (several calls for a JSON-RPC batch)
+type callTiming struct {
+	nanos atomic.Int64
+	calls atomic.Int64
+}
+
+// recordTiming adds the duration of a plugin call to the timing of the request
+func recordTiming(ctx context.Context, duration time.Duration) {
+	if timing, ok := ctx.Value(timingKey{}).(*callTiming); ok {
+		timing.nanos.Add(int64(duration))
+		timing.calls.Add(1)
+	}
+}
+
+// timingWriter sets the Server-Timing header before the status line
+type timingWriter struct {
+	http.ResponseWriter
+	timing  *callTiming
+	written bool
+}
+
+func (w *timingWriter) WriteHeader(status int) {
+	if !w.written {
+		w.written = true
+		// no plugin call: no header (eg: /health, invalid request)
+		if w.timing.calls.Load() > 0 {
+			ms := float64(w.timing.nanos.Load()) / float64(time.Millisecond)
+			w.Header().Add("Server-Timing", fmt.Sprintf("plugin;dur=%.3f", ms))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timingWriter) Write(data []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WithServerTiming sends the duration of the plugin calls of the request
+// in a Server-Timing header: plugin;dur=<ms>
+func WithServerTiming(next http.Handler) http.Handler {
+	if !serverTiming {
+		return next
+	}
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		timing := &callTiming{}
+		ctx := context.WithValue(request.Context(), timingKey{}, timing)
+		next.ServeHTTP(&timingWriter{ResponseWriter: response, timing: timing}, request.WithContext(ctx))
+	})
+}
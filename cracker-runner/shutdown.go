@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// the runner is shutting down: the late arrivals get a 503
+var shuttingDown atomic.Bool
+
+// runningCall is an in-flight call of a plugin function
+type runningCall struct {
+	function string
+	start    time.Time
+}
+
+var running = struct {
+	sync.Mutex
+	calls map[*runningCall]struct{}
+}{calls: map[*runningCall]struct{}{}}
+
+func startCall(function string) *runningCall {
+	call := &runningCall{function: function, start: time.Now()}
+	running.Lock()
+	defer running.Unlock()
+	running.calls[call] = struct{}{}
+	return call
+}
+
+func (call *runningCall) end() {
+	running.Lock()
+	defer running.Unlock()
+	delete(running.calls, call)
+}
+
+// Shutdown stops the servers, waiting at most timeout for the in-flight
+// calls; past the grace period, the still running functions are logged
+// and the servers closed; the admin server (-admin-addr, may be nil) stops
+// last, /readyz and /stats answer until the plugin routes are done
+func Shutdown(server *http.Server, adminServer *http.Server, grpcServer *grpc.Server, timeout time.Duration) {
+	log.Println("🛑 shutting down, grace period:", timeout)
+	shuttingDown.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		err := server.Shutdown(ctx)
+		if err == nil && grpcServer != nil {
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		if err == nil && adminServer != nil {
+			err = adminServer.Shutdown(ctx)
+		}
+		result <- err
+	}()
+
+	if err := <-result; err != nil {
+		running.Lock()
+		for call := range running.calls {
+			log.Println("🐢", call.function, "still running after", time.Since(call.start).Round(time.Millisecond))
+		}
+		running.Unlock()
+		server.Close()
+		if adminServer != nil {
+			adminServer.Close()
+		}
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		log.Println("💥 forced close after", timeout)
+		return
+	}
+	log.Println("👋 bye")
+}
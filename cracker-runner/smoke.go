@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// realistic input of a call of the default function which must succeed
+// before /readyz answers 200 (-smoke-input), disabled when nil
+var smokeInput []byte
+
+// function of the smoke call (the default function)
+var smokeFunction string
+
+// expected part of the output of the smoke call (-smoke-expect), any output when empty
+var smokeExpect string
+
+var errSmokePending = errors.New("smoke call in progress")
+
+var smoke struct {
+	sync.Mutex
+	passed  bool
+	running bool
+	checked time.Time
+	err     error
+	// incremented at each reload: the result of a previous plugin is ignored
+	generation int
+}
+
+// LoadSmokeInput returns the input of the -smoke-input flag, @file reads it from a file
+func LoadSmokeInput(value string) ([]byte, error) {
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		return os.ReadFile(path)
+	}
+	return []byte(value), nil
+}
+
+// SmokeCheck returns nil once the smoke call of the stored plugin passed;
+// until then it starts the call in the background (again healthCacheTTL
+// after a failure) and returns why the plugin is not ready
+func SmokeCheck() error {
+	if smokeInput == nil {
+		return nil
+	}
+	smoke.Lock()
+	defer smoke.Unlock()
+	if smoke.passed {
+		return nil
+	}
+	if !smoke.running && time.Since(smoke.checked) >= healthCacheTTL {
+		smoke.running = true
+		go runSmoke(smoke.generation)
+	}
+	if smoke.err != nil {
+		return smoke.err
+	}
+	return errSmokePending
+}
+
+// runSmoke calls the default function (pipeline included) with the smoke input
+func runSmoke(generation int) {
+	start := time.Now()
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "smoke")
+	ctx, cancel, _ := WithCallTimeout(ctx, callTimeout)
+	defer cancel()
+	out, err := CallPipeline(ctx, smokeFunction, smokeInput)
+	if err == nil && smokeExpect != "" && !bytes.Contains(out, []byte(smokeExpect)) {
+		err = fmt.Errorf("answered %q, expected %q in the output", out, smokeExpect)
+	}
+
+	smoke.Lock()
+	defer smoke.Unlock()
+	if generation != smoke.generation {
+		return
+	}
+	smoke.running = false
+	smoke.checked = time.Now()
+	if err != nil {
+		smoke.err = fmt.Errorf("smoke call of %s: %w", smokeFunction, err)
+		log.Println("🟡 not ready:", smoke.err)
+		return
+	}
+	smoke.passed, smoke.err = true, nil
+	log.Println("💨 smoke call of", smokeFunction, "passed in", time.Since(start).Round(time.Microsecond))
+}
+
+// resetSmoke runs the smoke call again on the new plugin of a reload
+func resetSmoke() {
+	smoke.Lock()
+	defer smoke.Unlock()
+	smoke.generation++
+	smoke.passed, smoke.running, smoke.err = false, false, nil
+	smoke.checked = time.Time{}
+}
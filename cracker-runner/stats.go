@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upper bounds (bytes) of the buckets of the input size histograms
+var inputBuckets = []int64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// Histogram counts the values by bucket (le: upper bound, "+Inf" for the last one)
+type Histogram struct {
+	Buckets []Bucket `json:"buckets"`
+	Count   int64    `json:"count"`
+	Sum     int64    `json:"sum"`
+}
+
+type Bucket struct {
+	Le    string `json:"le"`
+	Count int64  `json:"count"`
+}
+
+func NewHistogram(bounds []int64) Histogram {
+	var buckets []Bucket
+	for _, bound := range bounds {
+		buckets = append(buckets, Bucket{Le: strconv.FormatInt(bound, 10)})
+	}
+	return Histogram{Buckets: append(buckets, Bucket{Le: "+Inf"})}
+}
+
+func (h *Histogram) Observe(bounds []int64, value int64) {
+	h.Count++
+	h.Sum += value
+	for i, bound := range bounds {
+		if value <= bound {
+			h.Buckets[i].Count++
+			return
+		}
+	}
+	h.Buckets[len(bounds)].Count++
+}
+
+// FunctionStats are the metrics of the calls of a function
+type FunctionStats struct {
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+	// calls refused with a 413 (input over the limit)
+	Rejected int64 `json:"rejected"`
+	// calls refused with a 429 (-max-concurrent)
+	Throttled int64 `json:"throttled"`
+	// calls answered with the result of an identical call in flight (-coalesce)
+	Coalesced  int64     `json:"coalesced"`
+	InputBytes Histogram `json:"inputBytes"`
+}
+
+// InstanceStats are the gauges of an open plugin instance
+type InstanceStats struct {
+	Plugin   string `json:"plugin"`
+	Instance int    `json:"instance"`
+	// an instance of the pool of the plugin instance (-pool-max)
+	Pooled bool `json:"pooled,omitempty"`
+	// linear memory pages (64 KiB) of the modules of the instance
+	MemoryPages int64 `json:"memoryPages"`
+}
+
+// compilations of the plugin (its loads), their time (nanoseconds), and
+// the instances created from a compilation (-pool-max, -fresh-instance)
+var compiles, compileTime, compiledInstances atomic.Int64
+
+// CompileStats are the counters of the compilations in /stats: a load
+// compiles the plugin (a miss), an instance of the pool or a fresh instance
+// reuses the compilation of the stored plugin (a hit)
+type CompileStats struct {
+	Compiles      int64 `json:"compiles"`
+	CompileTimeMs int64 `json:"compileTimeMs"`
+	// instances created without compiling
+	Reused int64 `json:"reused"`
+	// compile time of the reused instances, at the average compile time
+	SavedTimeMs int64 `json:"savedTimeMs"`
+}
+
+// CurrentCompileStats returns the counters of the compilations since the start
+func CurrentCompileStats() CompileStats {
+	count, total, reused := compiles.Load(), compileTime.Load(), compiledInstances.Load()
+	stats := CompileStats{Compiles: count, CompileTimeMs: time.Duration(total).Milliseconds(), Reused: reused}
+	if count > 0 {
+		stats.SavedTimeMs = time.Duration(total / count * reused).Milliseconds()
+	}
+	return stats
+}
+
+// Stats are the metrics of the runner, served by GET /stats
+type Stats struct {
+	mutex     sync.Mutex
+	Functions map[string]*FunctionStats `json:"functions"`
+	// sampled when /stats is served
+	Instances []InstanceStats `json:"instances"`
+	// in-flight calls by function, sampled when /stats is served
+	InFlight map[string]int64 `json:"inFlight"`
+	Breaker  BreakerStats     `json:"breaker"`
+	// the pool of the current plugin (-pool-max)
+	Pool    *PoolStats   `json:"pool,omitempty"`
+	Compile CompileStats `json:"compile"`
+}
+
+var stats = &Stats{Functions: map[string]*FunctionStats{}}
+
+func (s *Stats) function(name string) *FunctionStats {
+	functionStats, ok := s.Functions[name]
+	if !ok {
+		functionStats = &FunctionStats{InputBytes: NewHistogram(inputBuckets)}
+		s.Functions[name] = functionStats
+	}
+	return functionStats
+}
+
+// Call records a call of the function
+func (s *Stats) Call(name string, inputSize int64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	functionStats := s.function(name)
+	functionStats.Calls++
+	if err != nil {
+		functionStats.Errors++
+	}
+	functionStats.InputBytes.Observe(inputBuckets, inputSize)
+}
+
+// Rejected records a call refused because of the size of its input
+func (s *Stats) Rejected(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.function(name).Rejected++
+}
+
+// Throttled records a call refused because of the concurrency cap of the function
+func (s *Stats) Throttled(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.function(name).Throttled++
+}
+
+// Coalesced records a call answered with the result of an identical call
+func (s *Stats) Coalesced(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.function(name).Coalesced++
+}
+
+// StatsHandler serves the metrics as JSON (GET /stats)
+func StatsHandler(response http.ResponseWriter, request *http.Request) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	stats.Instances = stats.Instances[:0]
+	m.Lock()
+	for _, inst := range instances {
+		stats.Instances = append(stats.Instances, InstanceStats{
+			Plugin:      inst.name,
+			Instance:    inst.index,
+			MemoryPages: inst.memory.Pages(),
+		})
+		if inst.pool != nil {
+			stats.Instances = append(stats.Instances, inst.pool.InstanceStats()...)
+		}
+	}
+	stats.Pool = nil
+	if inst, ok := plugins["code"]; ok && inst.pool != nil {
+		poolStats := inst.pool.Stats()
+		stats.Pool = &poolStats
+	}
+	m.Unlock()
+	stats.InFlight = InFlight()
+	stats.Breaker = breaker.Stats()
+	stats.Compile = CurrentCompileStats()
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(stats)
+}
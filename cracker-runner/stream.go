@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// largest chunk returned by read_chunk
+const maxChunkBytes = 64 << 10
+
+// bodyStream is the request body of a streamed call, pulled by the plugin
+// with read_chunk while the call runs (the context of the call carries it)
+type bodyStream struct {
+	function string
+	reader   io.Reader
+	// bytes read by the plugin
+	size int64
+	// error of the body (eg: over the input limit), returned by the call
+	err error
+}
+
+type bodyStreamKey struct{}
+
+// ReadChunk is the read_chunk(max: i64) -> i64 host function (extism:host/user):
+// it copies the next chunk of the request body (at most max bytes, max 64 KiB)
+// into the memory of the plugin and returns its offset, or 0 at the end of the
+// body (and outside a streamed call)
+var ReadChunk = extism.NewHostFunctionWithStack(
+	"read_chunk",
+	func(ctx context.Context, plugin *extism.CurrentPlugin, stack []uint64) {
+		stream, ok := ctx.Value(bodyStreamKey{}).(*bodyStream)
+		if !ok || stream.err != nil {
+			stack[0] = 0
+			return
+		}
+		size := maxChunkBytes
+		if stack[0] > 0 && stack[0] < maxChunkBytes {
+			size = int(stack[0])
+		}
+		buffer := make([]byte, size)
+		n, err := io.ReadAtLeast(stream.reader, buffer, 1)
+		if n == 0 {
+			if err != io.EOF {
+				stream.err = bodyError(stream.function, err)
+			}
+			stack[0] = 0
+			return
+		}
+		stream.size += int64(n)
+		offset, err := plugin.WriteBytes(buffer[:n])
+		if err != nil {
+			stream.err = err
+			stack[0] = 0
+			return
+		}
+		stack[0] = offset
+	},
+	[]extism.ValueType{extism.ValueTypeI64},
+	[]extism.ValueType{extism.ValueTypePTR},
+)
+
+// CallPluginStream calls a function of the stored plugin with an empty input,
+// the plugin pulls the body with read_chunk instead (nothing is buffered)
+func CallPluginStream(ctx context.Context, functionName string, body io.Reader) ([]byte, error) {
+	stream := &bodyStream{function: functionName, reader: body}
+	ctx = context.WithValue(ctx, bodyStreamKey{}, stream)
+	return callPlugin(ctx, functionName, nil, stream)
+}
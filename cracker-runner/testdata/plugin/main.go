@@ -0,0 +1,79 @@
+// the plugin of the tests of the runner, built by TestMain:
+// GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o plugin.wasm .
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/extism/go-pdk"
+)
+
+//go:wasmexport say_hello
+func say_hello() int32 {
+	pdk.OutputString("hello " + string(pdk.Input()))
+	return 0
+}
+
+// spin is busy for the input milliseconds: a slow call
+//
+//go:wasmexport spin
+func spin() int32 {
+	ms, _ := strconv.Atoi(string(pdk.Input()))
+	// the wall clock: the monotonic clock of the runtime is fake
+	deadline := time.Now().UnixMilli() + int64(ms)
+	for time.Now().UnixMilli() < deadline {
+	}
+	pdk.OutputString("spun " + string(pdk.Input()))
+	return 0
+}
+
+// fetch returns the body of the input URL (GET): a call as slow as the server
+//
+//go:wasmexport fetch
+func fetch() int32 {
+	response := pdk.NewHTTPRequest(pdk.MethodGet, string(pdk.Input())).Send()
+	pdk.Output(response.Body())
+	return 0
+}
+
+// the state of the instance, kept between its calls
+var count int
+
+//go:wasmexport counter
+func counter() int32 {
+	count++
+	pdk.OutputString(strconv.Itoa(count))
+	return 0
+}
+
+// png returns a 1x1 PNG image
+//
+//go:wasmexport png
+func pngImage() int32 {
+	var out bytes.Buffer
+	png.Encode(&out, image.NewGray(image.Rect(0, 0, 1, 1)))
+	pdk.Output(out.Bytes())
+	return 0
+}
+
+// emit sends a record to the client of a streamed call (-stream-ndjson)
+//
+//go:wasmimport extism:host/user emit
+func emit(record uint64) uint64
+
+// flood emits 64 KiB records until they are dropped
+//
+//go:wasmexport flood
+func flood() int32 {
+	record := pdk.AllocateString(strings.Repeat("x", 64<<10))
+	for emit(record.Offset()) == 0 {
+	}
+	return 0
+}
+
+func main() {}
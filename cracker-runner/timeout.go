@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// default deadline of a call (-call-timeout) and largest deadline a client
+// can ask with X-Call-Timeout-Ms (-max-call-timeout), 0 = none
+var callTimeout time.Duration
+var maxCallTimeout time.Duration
+
+var ErrCallTimeout = errors.New("call timeout")
+
+// largestTimeout returns the largest deadline of a call, 0 when the calls have no deadline
+func largestTimeout() time.Duration {
+	if maxCallTimeout > 0 {
+		return maxCallTimeout
+	}
+	return callTimeout
+}
+
+// CallTimeout returns the timeout of a call: the client one clamped to the
+// largest deadline, -call-timeout when the client has none
+func CallTimeout(client time.Duration) time.Duration {
+	largest := largestTimeout()
+	if largest == 0 {
+		return 0
+	}
+	if client <= 0 {
+		client = callTimeout
+	}
+	if client <= 0 {
+		return largest
+	}
+	return min(client, largest)
+}
+
+// callContext returns the context of the call of the request, with the
+// timeout of the X-Call-Timeout-Ms header, the method and the per-call
+// config (X-Plugin-Config); the call is not canceled with the
+// request, a canceled call closes the plugin
+func callContext(request *http.Request) (context.Context, context.CancelFunc, error) {
+	var client time.Duration
+	if header := request.Header.Get("X-Call-Timeout-Ms"); header != "" {
+		ms, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || ms <= 0 {
+			return nil, nil, fmt.Errorf("invalid X-Call-Timeout-Ms header: %q", header)
+		}
+		client = time.Duration(ms) * time.Millisecond
+	}
+	config, err := CallConfig(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := WithCallConfig(WithMethod(request.Context(), request.Method), config)
+	return WithCallTimeout(ctx, CallTimeout(client))
+}
+
+type requestDoneKey struct{}
+
+// WithCallTimeout returns the context of a call, only canceled by the
+// timeout; it keeps the end of the request for the waits before the call
+func WithCallTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	ctx = context.WithValue(context.WithoutCancel(ctx), requestDoneKey{}, ctx.Done())
+	if timeout <= 0 {
+		return ctx, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// requestDone returns a channel closed when the client of the call is gone
+// (nil, never closed, for the calls without a client)
+func requestDone(ctx context.Context) <-chan struct{} {
+	done, _ := ctx.Value(requestDoneKey{}).(<-chan struct{})
+	return done
+}
+
+// moduleClosed returns true when the runtime closed the module of the plugin
+// during the call (deadline, exit of the guest); closed by the context once
+// the guest returned, Extism fails to read the output with a plain error
+func moduleClosed(ctx context.Context, err error) (*sys.ExitError, bool) {
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr, true
+	}
+	if err != nil {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			return sys.NewExitError(sys.ExitCodeDeadlineExceeded), true
+		case context.Canceled:
+			return sys.NewExitError(sys.ExitCodeContextCanceled), true
+		}
+	}
+	return nil, false
+}
+
+// replaceClosed loads the plugin again to replace an instance closed by a
+// call (inst is locked): the calls waiting for it go to the new one
+func replaceClosed(inst *instance) {
+	inst.closed = true
+	log.Println("♻️ plugin closed by a call, loading it again")
+	replacement, err := LoadPlugin(context.Background(), currentSource())
+
+	m.Lock()
+	defer m.Unlock()
+	if plugins["code"] != inst {
+		// already replaced (reload)
+		if err == nil {
+			replacement.close(context.Background())
+		}
+		return
+	}
+	if err != nil {
+		log.Println("🔴 !!! Error when loading the plugin again", err)
+		delete(plugins, "code")
+		inst.replaced = true
+		inst.closeIfIdle()
+		return
+	}
+	storePlugin(replacement)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// functions called at startup (-warmup-functions), "all" for every exported function
+var warmupFunctions ListFlag
+
+// sample inputs of the warmup calls (-warmup-input), empty by default
+var warmupInputs = InputFlag{}
+
+// exports of the runtimes, not functions of the plugin
+var runtimeExports = []string{"_start", "_initialize", "hs_init"}
+
+// InputFlag is a repeatable fn=input flag, fn=@file reads the input from a file
+type InputFlag map[string][]byte
+
+func (f InputFlag) String() string {
+	var names []string
+	for name := range f {
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (f InputFlag) Set(value string) error {
+	name, input, ok := strings.Cut(value, "=")
+	if !ok || !functionName.MatchString(name) {
+		return fmt.Errorf("expected function=input or function=@file, got %q", value)
+	}
+	if path, ok := strings.CutPrefix(input, "@"); ok {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f[name] = content
+		return nil
+	}
+	f[name] = []byte(input)
+	return nil
+}
+
+// WarmupFunctions returns the functions to warm, the exported functions of the plugin with "all"
+func WarmupFunctions(inst *instance) []string {
+	var functions []string
+	for _, value := range warmupFunctions {
+		functions = append(functions, strings.Split(value, ",")...)
+	}
+	if !slices.Contains(functions, "all") {
+		return functions
+	}
+	return exportedFunctions(inst)
+}
+
+// exportedFunctions returns the functions of the plugin, without the
+// runtime exports and the schema, init and health functions
+func exportedFunctions(inst *instance) []string {
+	var functions []string
+	for name := range inst.plugin.Module().ExportedFunctions() {
+		if functionName.MatchString(name) && !strings.HasPrefix(name, "__") && name != schemaFunction && name != initFunction && name != healthFunction && !slices.Contains(runtimeExports, name) {
+			functions = append(functions, name)
+		}
+	}
+	slices.Sort(functions)
+	return functions
+}
+
+// Warmup calls each function of the instance, and of the warm instances of
+// its pool, with its sample input before it gets traffic (not stored yet),
+// the first failure is returned
+func Warmup(ctx context.Context, inst *instance, functions []string) error {
+	if err := warmInstance(ctx, inst, functions); err != nil {
+		return err
+	}
+	if inst.pool != nil {
+		return inst.pool.warmup(ctx, functions)
+	}
+	return nil
+}
+
+func warmInstance(ctx context.Context, inst *instance, functions []string) error {
+	for _, function := range functions {
+		if !inst.plugin.FunctionExists(function) {
+			return fmt.Errorf("warmup of %s: %w", function, ErrUnknownFunction)
+		}
+		start := time.Now()
+		callCtx, cancel, _ := WithCallTimeout(ctx, callTimeout)
+		inst.startGuestLogs(ctx, function)
+		_, _, err := inst.plugin.CallWithContext(callCtx, function, warmupInputs[function])
+		cancel()
+		if inst.stdout != nil {
+			logStdout(ctx, function, inst.stdout)
+			inst.stdout.Reset()
+		}
+		if err != nil {
+			return fmt.Errorf("warmup of %s: %w", function, err)
+		}
+		log.Println("🔥 warmed", function, "in", time.Since(start).Round(time.Microsecond))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// URL notified of the reloads of the plugin (-reload-webhook), disabled when empty
+var reloadWebhook string
+
+// attempts of a webhook call, and the delay before the first retry (doubled at each retry)
+const (
+	webhookAttempts = 3
+	webhookBackoff  = time.Second
+)
+
+var webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+// ReloadEvent is the JSON body posted to the reload webhook
+type ReloadEvent struct {
+	Event  string `json:"event"`
+	Plugin string `json:"plugin"`
+	// hash of the main module of the loaded plugin (hex), the serving one
+	// when the reload failed
+	SHA256 string    `json:"sha256"`
+	At     time.Time `json:"at"`
+	// why the build of the new plugin failed (reload_failed event)
+	Error string `json:"error,omitempty"`
+}
+
+// NotifyReload posts a reload event to the webhook in the background,
+// with retries: the reload never waits for it
+func NotifyReload(inst *instance) {
+	notify(ReloadEvent{Event: "reload", Plugin: inst.name, SHA256: inst.module.SHA256, At: time.Now().UTC()})
+}
+
+// NotifyReloadFailed posts a reload_failed event: the new plugin didn't
+// build, the current one (sha256 of its main module) still serves
+func NotifyReloadFailed(name string, sha256 string, err error) {
+	notify(ReloadEvent{Event: "reload_failed", Plugin: name, SHA256: sha256, At: time.Now().UTC(), Error: err.Error()})
+}
+
+func notify(event ReloadEvent) {
+	if reloadWebhook == "" {
+		return
+	}
+	body, _ := json.Marshal(event)
+	go func() {
+		backoff := webhookBackoff
+		for attempt := 1; ; attempt++ {
+			err := postWebhook(body)
+			if err == nil {
+				return
+			}
+			if attempt == webhookAttempts {
+				log.Println("🔴 !!! Error when notifying the reload webhook", err)
+				return
+			}
+			log.Println("🔁 reload webhook failed, retrying:", err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}()
+}
+
+func postWebhook(body []byte) error {
+	response, err := webhookClient.Post(reloadWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", reloadWebhook, response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Approval asks the user before writing each generated test file (-interactive)
+type Approval struct {
+	in  *bufio.Reader
+	out io.Writer
+	// "apply all" or "skip all" answered during the session
+	applyAll, skipAll bool
+}
+
+func NewApproval(in io.Reader, out io.Writer) *Approval {
+	return &Approval{in: bufio.NewReader(in), out: out}
+}
+
+// Review shows the proposed content (or the diff against the existing file)
+// and returns the content to write and whether it should be written
+func (a *Approval) Review(path string, proposed []byte) ([]byte, bool, error) {
+	if a.applyAll {
+		return proposed, true, nil
+	}
+	if a.skipAll {
+		return nil, false, nil
+	}
+
+	for {
+		if err := a.show(path, proposed); err != nil {
+			return nil, false, err
+		}
+		fmt.Fprintf(a.out, "✋ write %s? [y]es / [n]o / [e]dit / [a]pply all / [s]kip all: ", path)
+		answer, err := a.in.ReadString('\n')
+		if err != nil && answer == "" {
+			return nil, false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return proposed, true, nil
+		case "n", "no":
+			return nil, false, nil
+		case "a", "all":
+			a.applyAll = true
+			return proposed, true, nil
+		case "s", "skip":
+			a.skipAll = true
+			return nil, false, nil
+		case "e", "edit":
+			edited, err := edit(proposed)
+			if err != nil {
+				fmt.Fprintln(a.out, "😡:", err)
+				continue
+			}
+			proposed = edited
+		}
+	}
+}
+
+// show prints the diff with the existing file, or the whole proposal for a new file
+func (a *Approval) show(path string, proposed []byte) error {
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(a.out, "📄 new file %s:\n%s\n", path, proposed)
+		return nil
+	}
+	tmp, err := writeTemp(proposed)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	cmd := exec.Command("diff", "-u", path, tmp)
+	cmd.Stdout = a.out
+	err = cmd.Run()
+	// diff exits with 1 when the files differ
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		fmt.Fprintf(a.out, "📄 %s (no diff available):\n%s\n", path, proposed)
+	}
+	return nil
+}
+
+// edit opens the proposal in $EDITOR (vi by default) and returns the edited content
+func edit(proposed []byte) ([]byte, error) {
+	tmp, err := writeTemp(proposed)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command(editor, tmp)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(tmp)
+}
+
+func writeTemp(content []byte) (string, error) {
+	file, err := os.CreateTemp("", "cracker-*_test.go")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
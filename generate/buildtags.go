@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"strings"
+)
+
+// BuildConstraint returns the build constraint of the header of a source
+// file (//go:build, or the legacy // +build lines), nil when it has none
+func BuildConstraint(source []byte) (constraint.Expr, error) {
+	var plusBuild []constraint.Expr
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// the constraints are only allowed before the package clause
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		switch {
+		case constraint.IsGoBuild(line):
+			return constraint.Parse(line)
+		case constraint.IsPlusBuild(line):
+			expr, err := constraint.Parse(line)
+			if err != nil {
+				return nil, err
+			}
+			plusBuild = append(plusBuild, expr)
+		}
+	}
+	return andAll(plusBuild), nil
+}
+
+// BuildConstraints returns the constraint of the tests of several source
+// files: all the constraints of the files, nil when none has one
+func BuildConstraints(sources [][]byte) (constraint.Expr, error) {
+	var exprs []constraint.Expr
+	seen := map[string]bool{}
+	for _, source := range sources {
+		expr, err := BuildConstraint(source)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil && !seen[expr.String()] {
+			seen[expr.String()] = true
+			exprs = append(exprs, expr)
+		}
+	}
+	return andAll(exprs), nil
+}
+
+// TagsConstraint returns the constraint of the -build-tags: all the tags
+func TagsConstraint(tags []string) (constraint.Expr, error) {
+	var exprs []constraint.Expr
+	for _, value := range tags {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag == "" {
+				continue
+			}
+			expr, err := constraint.Parse("//go:build " + tag)
+			if err != nil {
+				return nil, fmt.Errorf("invalid build tag %q: %v", tag, err)
+			}
+			exprs = append(exprs, expr)
+		}
+	}
+	return andAll(exprs), nil
+}
+
+func andAll(exprs []constraint.Expr) constraint.Expr {
+	var all constraint.Expr
+	for _, expr := range exprs {
+		if all == nil {
+			all = expr
+		} else {
+			all = &constraint.AndExpr{X: all, Y: expr}
+		}
+	}
+	return all
+}
+
+// WithBuildConstraint replaces the build constraint of the generated code
+// (the model may have written one) with expr, nothing to do when expr is nil
+func WithBuildConstraint(code string, expr constraint.Expr) string {
+	if expr == nil {
+		return code
+	}
+	var header []string
+	lines := strings.Split(code, "\n")
+	body := len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "package ") {
+			body = i
+			break
+		}
+		if constraint.IsGoBuild(trimmed) || constraint.IsPlusBuild(trimmed) {
+			continue
+		}
+		header = append(header, line)
+	}
+	rest := strings.TrimLeft(strings.Join(append(header, lines[body:]...), "\n"), "\n")
+	return "//go:build " + expr.String() + "\n\n" + rest
+}
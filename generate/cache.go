@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/openai/openai-go"
+)
+
+// Cache stores the completions on disk ($XDG_CACHE_HOME/cracker),
+// keyed by the hash of the request (model, prompt and source)
+type Cache struct {
+	dir string
+}
+
+// cacheEntry is the stored part of a completion
+type cacheEntry struct {
+	Model   string                 `json:"model"`
+	Content string                 `json:"content"`
+	Usage   openai.CompletionUsage `json:"usage"`
+}
+
+func NewCache() (*Cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "cracker")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// CacheKey is the sha256 of the request: model, messages (prompt + source) and sampling settings
+func CacheKey(param openai.ChatCompletionNewParams) (string, error) {
+	request, err := json.Marshal(param)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(request)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get returns the cached completion of the key
+func (c *Cache) Get(key string) (*openai.ChatCompletion, bool) {
+	data, err := os.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &openai.ChatCompletion{
+		Model: entry.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Content: entry.Content}},
+		},
+		Usage: entry.Usage,
+	}, true
+}
+
+// Put stores the completion under the key
+func (c *Cache) Put(key string, model string, completion *openai.ChatCompletion) error {
+	data, err := json.Marshal(cacheEntry{
+		Model:   model,
+		Content: completion.Choices[0].Message.Content,
+		Usage:   completion.Usage,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.dir, key+".json"), data, 0644)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// lineRange is an inclusive range of line numbers in the new version of a file
+type lineRange struct {
+	start, end int
+}
+
+// hunk header of a unified diff, eg: @@ -12,3 +12,5 @@
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// ChangedFunctions returns the names of the functions (and methods) of the
+// source file touched by `git diff` against baseRef
+func ChangedFunctions(filePath string, source []byte, baseRef string) ([]string, error) {
+	ranges, err := changedLines(filePath, baseRef)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, filePath, source, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var functions []string
+	for _, decl := range parsed.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		// the doc comment belongs to the function
+		start := fset.Position(fn.Pos()).Line
+		if fn.Doc != nil {
+			start = fset.Position(fn.Doc.Pos()).Line
+		}
+		end := fset.Position(fn.End()).Line
+		for _, r := range ranges {
+			if r.start <= end && r.end >= start {
+				functions = append(functions, funcName(fn))
+				break
+			}
+		}
+	}
+	return functions, nil
+}
+
+// funcName returns "Name" for a function and "Type.Name" for a method
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	// generic receivers: T[K] or T[K, V]
+	switch t := typ.(type) {
+	case *ast.IndexExpr:
+		typ = t.X
+	case *ast.IndexListExpr:
+		typ = t.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// changedLines runs `git diff` and collects the line ranges added or modified
+// in the working tree version of the file, the whole file when it's untracked
+// (git diff ignores it)
+func changedLines(filePath string, baseRef string) ([]lineRange, error) {
+	dir, name := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+	if exec.Command("git", "-C", dir, "ls-files", "--error-unmatch", "--", name).Run() != nil {
+		// a new file: all its functions are new
+		return []lineRange{{1, math.MaxInt}}, nil
+	}
+	cmd := exec.Command("git", "-C", dir, "diff", "--unified=0", "--no-color", baseRef, "--", name)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var ranges []lineRange
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		match := hunkHeader.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(match[1])
+		count := 1
+		if match[2] != "" {
+			count, _ = strconv.Atoi(match[2])
+		}
+		if count == 0 {
+			// pure deletion: the change sits between two lines
+			ranges = append(ranges, lineRange{start, start + 1})
+			continue
+		}
+		ranges = append(ranges, lineRange{start, start + count - 1})
+	}
+	return ranges, scanner.Err()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// Complete runs the chat completion, streaming the answer to stream if not nil.
+// A zero timeout means no deadline.
+func Complete(ctx context.Context, client openai.Client, param openai.ChatCompletionNewParams, stream io.Writer, timeout time.Duration) (*openai.ChatCompletion, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var completion *openai.ChatCompletion
+	var err error
+	if stream != nil {
+		completion, err = CompleteStreaming(ctx, client, param, stream)
+	} else {
+		completion, err = client.Chat.Completions.New(ctx, param)
+		if err == nil && len(completion.Choices) == 0 {
+			err = fmt.Errorf("empty completion")
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("model %s timed out after %s", param.Model, timeout)
+	}
+	return completion, err
+}
+
+// CompleteStreaming runs the chat completion in streaming mode:
+// the deltas are written to w as they arrive, and the accumulated
+// completion is returned once the stream is over
+func CompleteStreaming(ctx context.Context, client openai.Client, param openai.ChatCompletionNewParams, w io.Writer) (*openai.ChatCompletion, error) {
+	// ask for the token usage in the last chunk
+	param.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	stream := client.Chat.Completions.NewStreaming(ctx, param)
+	defer stream.Close()
+
+	acc := openai.ChatCompletionAccumulator{}
+	received := 0
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+		if len(chunk.Choices) > 0 {
+			delta := chunk.Choices[0].Delta.Content
+			received += len(delta)
+			fmt.Fprint(w, delta)
+		}
+	}
+	if received > 0 {
+		fmt.Fprintln(w)
+	}
+
+	if err := stream.Err(); err != nil {
+		if received > 0 {
+			return nil, fmt.Errorf("stream interrupted after %d bytes (partial output discarded): %w", received, err)
+		}
+		return nil, err
+	}
+	if len(acc.Choices) == 0 {
+		return nil, fmt.Errorf("empty completion stream")
+	}
+	return &acc.ChatCompletion, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// config file names, searched upward from the working directory
+var configFiles = []string{"cracker.yaml", "cracker.yml", "cracker.toml"}
+
+// Config is the project configuration file: the default values of the flags
+type Config struct {
+	Model        string   `yaml:"model" toml:"model"`
+	BaseURL      string   `yaml:"base_url" toml:"base_url"`
+	Provider     string   `yaml:"provider" toml:"provider"`
+	APIPath      string   `yaml:"api_path" toml:"api_path"`
+	Framework    string   `yaml:"framework" toml:"framework"`
+	Style        string   `yaml:"style" toml:"style"`
+	Temperature  *float64 `yaml:"temperature" toml:"temperature"`
+	Timeout      string   `yaml:"timeout" toml:"timeout"`
+	Exclude      []string `yaml:"exclude" toml:"exclude"`
+	SkipFuncs    []string `yaml:"skip_functions" toml:"skip_functions"`
+	OutputFormat string   `yaml:"output_format" toml:"output_format"`
+	Mode         string   `yaml:"mode" toml:"mode"`
+	MockStyle    string   `yaml:"mock_style" toml:"mock_style"`
+	// named model endpoints, selected with -profile
+	Profiles map[string]Profile `yaml:"profiles" toml:"profiles"`
+}
+
+// Profile is a named model endpoint of the config file, its values win over
+// the top-level ones
+type Profile struct {
+	Model    string `yaml:"model" toml:"model"`
+	BaseURL  string `yaml:"base_url" toml:"base_url"`
+	Provider string `yaml:"provider" toml:"provider"`
+	APIPath  string `yaml:"api_path" toml:"api_path"`
+	Timeout  string `yaml:"timeout" toml:"timeout"`
+}
+
+// environment variables winning over the config file
+var configEnv = map[string]string{
+	"model":    "LLM",
+	"base-url": "MODEL_RUNNER_BASE_URL",
+}
+
+// FindConfig searches the config file from dir up to the root, "" when there is none
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range configFiles {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads a YAML or TOML config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if strings.HasSuffix(path, ".toml") {
+		err = toml.Unmarshal(data, config)
+	} else {
+		err = yaml.Unmarshal(data, config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// SelectProfile applies the profile over the top-level values of the config
+func (c *Config) SelectProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		var names []string
+		for known := range c.Profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q, the config has: %s", name, strings.Join(names, ", "))
+	}
+	for _, field := range []struct{ value, profile *string }{
+		{&c.Model, &profile.Model},
+		{&c.BaseURL, &profile.BaseURL},
+		{&c.Provider, &profile.Provider},
+		{&c.APIPath, &profile.APIPath},
+		{&c.Timeout, &profile.Timeout},
+	} {
+		if *field.profile != "" {
+			*field.value = *field.profile
+		}
+	}
+	return nil
+}
+
+// Apply sets the flags that were not given on the command line
+// (nor by their environment variable) to the values of the config file
+func (c *Config) Apply(flags *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	values := map[string][]string{
+		"model":         {c.Model},
+		"base-url":      {c.BaseURL},
+		"provider":      {c.Provider},
+		"api-path":      {c.APIPath},
+		"framework":     {c.Framework},
+		"style":         {c.Style},
+		"timeout":       {c.Timeout},
+		"output-format": {c.OutputFormat},
+		"mode":          {c.Mode},
+		"mock-style":    {c.MockStyle},
+		"skip-file":     c.Exclude,
+		"skip-func":     c.SkipFuncs,
+	}
+	if c.Temperature != nil {
+		values["temperature"] = []string{strconv.FormatFloat(*c.Temperature, 'f', -1, 64)}
+	}
+
+	for name, list := range values {
+		if explicit[name] {
+			continue
+		}
+		if env := configEnv[name]; env != "" && os.Getenv(env) != "" {
+			continue
+		}
+		for _, value := range list {
+			if value == "" {
+				continue
+			}
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("config %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
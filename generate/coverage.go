@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/cover"
+	"golang.org/x/tools/go/packages"
+)
+
+// Gap is a function of the source file below the coverage threshold
+type Gap struct {
+	Function  string
+	Percent   float64
+	Uncovered []lineRange
+}
+
+func (g Gap) String() string {
+	var lines []string
+	for _, r := range g.Uncovered {
+		if r.start == r.end {
+			lines = append(lines, fmt.Sprint(r.start))
+		} else {
+			lines = append(lines, fmt.Sprintf("%d-%d", r.start, r.end))
+		}
+	}
+	return fmt.Sprintf("%s (%.0f%% covered, uncovered lines: %s)", g.Function, g.Percent, strings.Join(lines, ", "))
+}
+
+// CoverageGaps returns the functions of the source file whose statement
+// coverage in the profile (go test -coverprofile) is below threshold (percent)
+func CoverageGaps(profilePath string, filePath string, source []byte, threshold float64) ([]Gap, error) {
+	profiles, err := cover.ParseProfiles(profilePath)
+	if err != nil {
+		return nil, err
+	}
+	profile := findProfile(profiles, filePath)
+	if profile == nil {
+		return nil, fmt.Errorf("%s is not in the coverage profile %s", filePath, profilePath)
+	}
+
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, filePath, source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	var gaps []Gap
+	for _, decl := range parsed.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		start, end := fset.Position(fn.Pos()).Line, fset.Position(fn.End()).Line
+		total, covered := 0, 0
+		var uncovered []lineRange
+		for _, block := range profile.Blocks {
+			if block.StartLine < start || block.EndLine > end {
+				continue
+			}
+			total += block.NumStmt
+			if block.Count > 0 {
+				covered += block.NumStmt
+			} else if block.NumStmt > 0 {
+				uncovered = append(uncovered, lineRange{block.StartLine, block.EndLine})
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		percent := 100 * float64(covered) / float64(total)
+		if percent < threshold {
+			gaps = append(gaps, Gap{Function: funcName(fn), Percent: percent, Uncovered: uncovered})
+		}
+	}
+	return gaps, nil
+}
+
+// findProfile returns the profile of the file: profiles are named by
+// import path (module/pkg/file.go), the base name is the fallback
+func findProfile(profiles []*cover.Profile, filePath string) *cover.Profile {
+	absPath, err := filepath.Abs(filePath)
+	if err == nil {
+		pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName, Dir: filepath.Dir(absPath)}, "file="+absPath)
+		if err == nil && len(pkgs) == 1 && pkgs[0].PkgPath != "" {
+			name := pkgs[0].PkgPath + "/" + filepath.Base(filePath)
+			for _, profile := range profiles {
+				if profile.FileName == name {
+					return profile
+				}
+			}
+		}
+	}
+	var found *cover.Profile
+	for _, profile := range profiles {
+		if strings.HasSuffix(profile.FileName, "/"+filepath.Base(filePath)) {
+			if found != nil {
+				// ambiguous
+				return nil
+			}
+			found = profile
+		}
+	}
+	return found
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// DebugLog logs the prompts and the completions (-debug) without leaking
+// the source code into shared CI logs: the texts are truncated to Lines
+// lines unless Full (-debug-full), the secrets are never logged
+type DebugLog struct {
+	Lines int
+	Full  bool
+	// values replaced in all the logged texts (eg: the API key)
+	Secrets []string
+}
+
+// Printf logs a debug message, with the secrets redacted
+func (d *DebugLog) Printf(format string, args ...any) {
+	if d == nil {
+		return
+	}
+	log.Print("🐛 " + d.Redact(fmt.Sprintf(format, args...)))
+}
+
+// Text logs a text which may contain source code (prompt, completion)
+func (d *DebugLog) Text(label string, text string) {
+	if d == nil {
+		return
+	}
+	if !d.Full {
+		text = Truncate(text, d.Lines)
+	}
+	d.Printf("%s:\n%s", label, text)
+}
+
+// Redact replaces the secrets of text with [REDACTED]
+func (d *DebugLog) Redact(text string) string {
+	for _, secret := range d.Secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "[REDACTED]")
+		}
+	}
+	return text
+}
+
+// Truncate keeps the first lines of text and notes the omitted ones
+func Truncate(text string, lines int) string {
+	all := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(all) <= lines {
+		return text
+	}
+	omitted := len(all) - lines
+	return strings.Join(all[:lines], "\n") + fmt.Sprintf("\n… %d more lines omitted (-debug-full to log them)", omitted)
+}
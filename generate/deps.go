@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// ImportsContext returns the declarations (types, func signatures, consts
+// and vars) of the same-module packages imported by the source file that the
+// file actually references, truncated to maxBytes
+func ImportsContext(filePath string, maxBytes int) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedModule,
+		Dir:  filepath.Dir(absPath),
+	}
+	pkgs, err := packages.Load(cfg, "file="+absPath)
+	if err != nil {
+		return "", err
+	}
+	if len(pkgs) == 0 || pkgs[0].Module == nil {
+		return "", fmt.Errorf("%s is not part of a Go module", filePath)
+	}
+	pkg := pkgs[0]
+	modulePath := pkg.Module.Path
+
+	fset := token.NewFileSet()
+	source, err := parser.ParseFile(fset, absPath, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return "", err
+	}
+	used := usedSelectors(source)
+
+	var context strings.Builder
+	for _, spec := range source.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if path != modulePath && !strings.HasPrefix(path, modulePath+"/") {
+			continue
+		}
+		imported, ok := pkg.Imports[path]
+		if !ok {
+			continue
+		}
+		name := imported.Name
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if len(used[name]) == 0 {
+			continue
+		}
+		summary, err := packageSummary(imported.GoFiles, used[name])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&context, "// package %s (%q)\n%s\n", imported.Name, path, summary)
+	}
+
+	text := context.String()
+	if maxBytes > 0 && len(text) > maxBytes {
+		text = text[:maxBytes] + "\n// ... (truncated)\n"
+	}
+	return text, nil
+}
+
+// usedSelectors returns, by package name, the identifiers referenced as pkg.Ident
+func usedSelectors(file *ast.File) map[string]map[string]bool {
+	used := map[string]map[string]bool{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		selector, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := selector.X.(*ast.Ident); ok {
+			if used[ident.Name] == nil {
+				used[ident.Name] = map[string]bool{}
+			}
+			used[ident.Name][selector.Sel.Name] = true
+		}
+		return true
+	})
+	return used
+}
+
+// packageSummary prints the declarations of the referenced names without the
+// function bodies, following the types used by those declarations and the
+// methods of the referenced types
+func packageSummary(goFiles []string, names map[string]bool) (string, error) {
+	fset := token.NewFileSet()
+	// declarations by name, methods by receiver type name
+	declared := map[string][]ast.Node{}
+	methods := map[string][]*ast.FuncDecl{}
+	for _, goFile := range goFiles {
+		file, err := parser.ParseFile(fset, goFile, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return "", err
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if !d.Name.IsExported() {
+					continue
+				}
+				d.Body, d.Doc = nil, nil
+				if d.Recv != nil {
+					receiver := strings.SplitN(funcName(d), ".", 2)[0]
+					methods[receiver] = append(methods[receiver], d)
+					continue
+				}
+				declared[d.Name.Name] = append(declared[d.Name.Name], d)
+			case *ast.GenDecl:
+				if d.Tok == token.IMPORT {
+					continue
+				}
+				for _, spec := range d.Specs {
+					node := &ast.GenDecl{Tok: d.Tok, Specs: []ast.Spec{spec}}
+					for _, name := range specNames(spec) {
+						declared[name] = append(declared[name], node)
+					}
+				}
+			}
+		}
+	}
+
+	var pending []string
+	for name := range names {
+		pending = append(pending, name)
+	}
+	visited := map[string]bool{}
+	printed := map[ast.Node]bool{}
+	var decls []string
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+
+		nodes := declared[name]
+		for _, method := range methods[name] {
+			nodes = append(nodes, method)
+		}
+		for _, node := range nodes {
+			if printed[node] {
+				continue
+			}
+			printed[node] = true
+			text, err := printNode(fset, node)
+			if err != nil {
+				return "", err
+			}
+			decls = append(decls, text)
+			// the identifiers used by the declaration may be types of the package
+			ast.Inspect(node, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok && declared[ident.Name] != nil {
+					pending = append(pending, ident.Name)
+				}
+				return true
+			})
+		}
+	}
+	sort.Strings(decls)
+	return strings.Join(decls, "\n"), nil
+}
+
+func specNames(spec ast.Spec) []string {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return []string{s.Name.Name}
+	case *ast.ValueSpec:
+		var names []string
+		for _, name := range s.Names {
+			names = append(names, name.Name)
+		}
+		return names
+	}
+	return nil
+}
+
+func printNode(fset *token.FileSet, node any) (string, error) {
+	var buffer bytes.Buffer
+	if err := printer.Fprint(&buffer, fset, node); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
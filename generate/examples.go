@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"log"
+	"strings"
+)
+
+// ExampleTargets returns the exported functions (and methods of the
+// exported types) of the source: the ones godoc shows examples for
+func ExampleTargets(filePath string, source []byte) ([]string, error) {
+	declared, err := DeclaredFunctions(filePath, source)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	for _, name := range declared {
+		if exportedFunction(name) {
+			targets = append(targets, name)
+		}
+	}
+	return targets, nil
+}
+
+// ExamplesPrompt returns the user message asking for the examples of the functions
+func ExamplesPrompt(packageName string, targets []string, sourceCode string) string {
+	return "Generate runnable Go examples (godoc `Example` functions, standard library only) " +
+		"for the following exported functions: " + strings.Join(targets, ", ") + ".\n" +
+		"- one `func ExampleXxx()` per function, without parameters and results (eg: `ExampleParse` for `Parse`, `ExampleStore_Get` for `Store.Get`), " +
+		"a second one for the same function gets a lowercase suffix (eg: `ExampleParse_empty`)\n" +
+		"- show a typical use, the way a user of the package would call it, and print the results with `fmt.Println`\n" +
+		"- end each example with an `// Output:` comment holding the exact printed lines, so `go test` runs and checks it: " +
+		"only print deterministic values (no time, randomness, map iteration order, pointers)\n" +
+		"- no `testing.T`, no assertions, no helpers\n" +
+		"The examples belong to the package `" + packageName + "`. " +
+		"Only answer with the Go code of the test file.\n" +
+		"Source code:\n" + sourceCode
+}
+
+// CheckExamples validates the generated examples: the code parses and has
+// at least one example; the examples without output comment are compiled
+// but not run by go test
+func CheckExamples(code string) error {
+	parsed, err := parser.ParseFile(token.NewFileSet(), "example_test.go", code, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("generated examples: %v", err)
+	}
+	examples := doc.Examples(parsed)
+	if len(examples) == 0 {
+		return errors.New("generated examples: no Example function")
+	}
+	var notRun []string
+	for _, example := range examples {
+		if example.Output == "" && !example.EmptyOutput {
+			notRun = append(notRun, "Example"+example.Name)
+		}
+	}
+	if len(notRun) > 0 {
+		log.Println("⚠️ examples without // Output: comment (compiled, not run):", strings.Join(notRun, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
+)
+
+// ImportPath returns the import path of the package of the source file,
+// resolved from its module
+func ImportPath(filePath string) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedModule,
+		Dir:  filepath.Dir(absPath),
+	}
+	pkgs, err := packages.Load(cfg, "file="+absPath)
+	if err != nil {
+		return "", err
+	}
+	if len(pkgs) == 0 || pkgs[0].Module == nil {
+		return "", fmt.Errorf("%s is not part of a Go module", filePath)
+	}
+	return pkgs[0].PkgPath, nil
+}
+
+// ExternalPrompt returns the instructions of the black-box tests (-external-test)
+func ExternalPrompt(packageName string, importPath string) string {
+	return "\n\nWrite black-box tests in the external test package `" + packageName + "_test`: " +
+		"import the package under test (`import \"" + importPath + "\"`), " +
+		"reference its identifiers as `" + packageName + ".Name`, " +
+		"and only exercise the exported API (the unexported functions, types and fields are not accessible)."
+}
+
+// ExternalPackage moves the generated tests to the <package>_test package,
+// importing the package under test when the tests reference it
+func ExternalPackage(code string, packageName string, importPath string, filename string) (string, error) {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, filename, code, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("generated code: %v", err)
+	}
+	parsed.Name.Name = packageName + "_test"
+	if usedSelectors(parsed)[packageName] != nil {
+		name := ""
+		if path.Base(importPath) != packageName {
+			name = packageName
+		}
+		astutil.AddNamedImport(fset, parsed, name, importPath)
+	}
+
+	var out bytes.Buffer
+	if err := printer.Fprint(&out, fset, parsed); err != nil {
+		return "", err
+	}
+	fixed, err := imports.Process(filename, out.Bytes(), nil)
+	if err != nil {
+		return "", err
+	}
+	return string(fixed), nil
+}
+
+// exportedFunction tells if a function (or a Type.Method) is reachable from
+// the external test package
+func exportedFunction(name string) bool {
+	for part := range strings.SplitSeq(name, ".") {
+		if !token.IsExported(part) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// FuzzTargets returns the functions (and methods) of the source taking a
+// []byte or a string parameter: the inputs a fuzzer can mutate
+func FuzzTargets(filePath string, source []byte) ([]string, error) {
+	parsed, err := parser.ParseFile(token.NewFileSet(), filePath, source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	for _, decl := range parsed.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil && (fn.Name.Name == "init" || fn.Name.Name == "main") {
+			continue
+		}
+		for _, param := range fn.Type.Params.List {
+			if fuzzable(param.Type) {
+				targets = append(targets, funcName(fn))
+				break
+			}
+		}
+	}
+	return targets, nil
+}
+
+// fuzzable tells if the type is string or []byte
+func fuzzable(typ ast.Expr) bool {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return t.Name == "string"
+	case *ast.ArrayType:
+		elt, ok := t.Elt.(*ast.Ident)
+		return t.Len == nil && ok && elt.Name == "byte"
+	}
+	return false
+}
+
+// FuzzPrompt returns the user message asking for the fuzz tests of the functions
+func FuzzPrompt(packageName string, targets []string, sourceCode string) string {
+	return "Generate Go fuzz tests (Go 1.18+ native fuzzing, standard library `testing` only) " +
+		"for the following functions: " + strings.Join(targets, ", ") + ".\n" +
+		"- one `func FuzzXxx(f *testing.F)` per function (eg: `FuzzParse` for `Parse`, `FuzzStoreGet` for `Store.Get`)\n" +
+		"- seed the corpus with `f.Add(...)`: a few valid inputs, edge cases (empty, very long, unicode, invalid encodings)\n" +
+		"- the arguments of `f.Add` match the parameters of the `f.Fuzz` function, in order and in type\n" +
+		"- call `f.Fuzz(func(t *testing.T, ...) {...})` with only fuzzable parameters (`[]byte`, `string`, integers, floats, `bool`), build the other arguments inside\n" +
+		"- check properties which hold for any input: no panic, errors instead of invalid results, round-trips (eg: decode(encode(x)) == x), invariants; " +
+		"never assert exact outputs of random inputs\n" +
+		"- skip the uninteresting inputs with `t.Skip()`\n" +
+		"The tests belong to the package `" + packageName + "`. " +
+		"Only answer with the Go code of the test file.\n" +
+		"Source code:\n" + sourceCode
+}
@@ -0,0 +1,644 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build/constraint"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// Generator generates the tests of source files with the settings of the command line
+type Generator struct {
+	Client        openai.Client
+	Model         string
+	FallbackModel string
+	Timeout       time.Duration
+	Stream        bool
+	OutputFormat  string
+	Changed       bool
+	BaseRef       string
+	Append        bool
+	Style         string
+	Framework     string
+	Temperature   float64
+	// tests (default) or mocks
+	Mode      string
+	MockStyle string
+	// temperature 0 and a fixed seed for reproducible runs
+	Deterministic bool
+	Seed          int64
+	// add the declarations of the same-module imported packages to the prompt
+	WithImports     bool
+	ImportsMaxBytes int
+	// add the declarations of all the files of the package to the prompt (it must type-check)
+	WithPackageContext     bool
+	PackageContextMaxBytes int
+	// coverage profile to target the coverage gaps (-coverprofile)
+	CoverProfile  string
+	CoverageBelow float64
+	// functions left out of the prompt (-skip-func)
+	SkipFunctions []string
+	// one-off instructions of the run (-instruction)
+	Instructions []string
+	// build tags of the generated file (-build-tags), instead of the
+	// build constraints of the sources
+	BuildTags []string
+	// completions cache, nil with -no-cache
+	Cache *Cache
+	// don't read the cache (but update it)
+	Refresh bool
+	// ask before writing each file when not nil
+	Approval *Approval
+	// user message template (-prompt-template), nil for the built-in prompt
+	PromptTemplate *template.Template
+	// report of the functions referenced by the tests, nil to disable
+	Intent io.Writer
+	// prompts and completions logged with -debug, nil to disable
+	Debug *DebugLog
+	// black-box tests in the <package>_test package (-external-test)
+	ExternalTest bool
+	// split the generated files over this number of lines (-max-file-lines), 0 = no limit
+	MaxFileLines int
+	// write a sidecar next to each generated file, and skip the files
+	// whose sidecar matches the request unless Force
+	Sidecar bool
+	Force   bool
+}
+
+// Result of the generation of a file
+type Result struct {
+	// nothing to generate, or nothing written
+	Skipped bool
+	Tokens  int64
+}
+
+// GenerateFile generates the tests of the source file and writes them
+// to output, or to stdout when output is empty
+func (g *Generator) GenerateFile(ctx context.Context, filePath string, output string) (Result, error) {
+	return g.GenerateFiles(ctx, []string{filePath}, output)
+}
+
+// source is a file of the generation
+type source struct {
+	path    string
+	content []byte
+	// the code sent in the prompt, without the skipped functions
+	code    string
+	removed []string
+}
+
+// GenerateFiles generates one test file for source files of the same package:
+// the model sees all the files, so the tests can use the helpers of each file
+func (g *Generator) GenerateFiles(ctx context.Context, filePaths []string, output string) (Result, error) {
+	var sources []source
+	var removed []string
+	for _, filePath := range filePaths {
+		// sourceCode = content of filePath
+		file, err := os.ReadFile(filePath)
+		if err != nil {
+			return Result{}, err
+		}
+		code, skipped, err := RemoveFunctions(filePath, file, g.SkipFunctions)
+		if err != nil {
+			return Result{}, err
+		}
+		sources = append(sources, source{path: filePath, content: file, code: code, removed: skipped})
+		removed = append(removed, skipped...)
+	}
+	if len(removed) > 0 {
+		log.Println("⏭️ skipped functions:", strings.Join(removed, ", "))
+	}
+
+	packageName := PackageName(sources[0].path, sources[0].content)
+	for _, src := range sources[1:] {
+		if name := PackageName(src.path, src.content); name != packageName {
+			return Result{}, fmt.Errorf("%s is in package %s, not %s", src.path, name, packageName)
+		}
+	}
+	filesName := strings.Join(filePaths, ", ")
+
+	// several files are concatenated with a marker before each one
+	sourceCode := sources[0].code
+	if len(sources) > 1 {
+		var combined strings.Builder
+		for _, src := range sources {
+			fmt.Fprintf(&combined, "// ---- file: %s ----\n%s\n", filepath.Base(src.path), src.code)
+		}
+		sourceCode = combined.String()
+	}
+
+	userContent := "Generate unit tests for the following source code:\n" + sourceCode
+	if len(sources) > 1 {
+		userContent = "Generate a single test file for the following files of the package " +
+			packageName + ":\n" + sourceCode
+	}
+
+	if g.Mode == "mocks" {
+		var interfaces []string
+		for _, src := range sources {
+			_, declared, err := Interfaces(src.path, src.content)
+			if err != nil {
+				return Result{}, err
+			}
+			interfaces = append(interfaces, declared...)
+		}
+		if len(interfaces) == 0 {
+			log.Println("🙂 no interface in", filesName)
+			return Result{Skipped: true}, nil
+		}
+		log.Println("🎭 mocking:", strings.Join(interfaces, ", "))
+		var err error
+		userContent, err = MocksPrompt(packageName, interfaces, g.MockStyle, sourceCode)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	var functions []string
+	if g.Changed && g.Mode != "mocks" {
+		for _, src := range sources {
+			changed, err := ChangedFunctions(src.path, src.content, g.BaseRef)
+			if err != nil {
+				return Result{}, err
+			}
+			for _, name := range changed {
+				if !slices.Contains(removed, name) {
+					functions = append(functions, name)
+				}
+			}
+		}
+		if len(functions) == 0 {
+			log.Println("🙂 no changed functions since", g.BaseRef, "in", filesName)
+			return Result{Skipped: true}, nil
+		}
+		log.Println("🔎 changed functions:", strings.Join(functions, ", "))
+		userContent = "Generate unit tests only for the following functions: " +
+			strings.Join(functions, ", ") +
+			". Do not generate tests for any other function.\n" +
+			"Source code:\n" + sourceCode
+	}
+
+	if g.Mode == "fuzz" {
+		var targets []string
+		for _, src := range sources {
+			declared, err := FuzzTargets(src.path, src.content)
+			if err != nil {
+				return Result{}, err
+			}
+			for _, name := range declared {
+				// with -changed, only the changed functions
+				if slices.Contains(removed, name) || (g.Changed && !slices.Contains(functions, name)) {
+					continue
+				}
+				targets = append(targets, name)
+			}
+		}
+		if len(targets) == 0 {
+			log.Println("🙂 no function taking a []byte or a string in", filesName)
+			return Result{Skipped: true}, nil
+		}
+		log.Println("🎲 fuzzing:", strings.Join(targets, ", "))
+		functions = targets
+		userContent = FuzzPrompt(packageName, targets, sourceCode)
+	}
+
+	if g.Mode == "examples" {
+		var targets []string
+		for _, src := range sources {
+			declared, err := ExampleTargets(src.path, src.content)
+			if err != nil {
+				return Result{}, err
+			}
+			for _, name := range declared {
+				// with -changed, only the changed functions
+				if slices.Contains(removed, name) || (g.Changed && !slices.Contains(functions, name)) {
+					continue
+				}
+				targets = append(targets, name)
+			}
+		}
+		if len(targets) == 0 {
+			log.Println("🙂 no exported function in", filesName)
+			return Result{Skipped: true}, nil
+		}
+		log.Println("📖 examples:", strings.Join(targets, ", "))
+		functions = targets
+		userContent = ExamplesPrompt(packageName, targets, sourceCode)
+	}
+
+	if g.CoverProfile != "" && g.Mode == "tests" {
+		var targets []string
+		for _, src := range sources {
+			gaps, err := CoverageGaps(g.CoverProfile, src.path, src.content, g.CoverageBelow)
+			if err != nil {
+				return Result{}, err
+			}
+			for _, gap := range gaps {
+				if slices.Contains(removed, gap.Function) {
+					continue
+				}
+				// with -changed, only the changed functions with gaps
+				if g.Changed && !slices.Contains(functions, gap.Function) {
+					continue
+				}
+				targets = append(targets, gap.String())
+			}
+		}
+		if len(targets) == 0 {
+			log.Println("🙂 no coverage gap in", filesName)
+			return Result{Skipped: true}, nil
+		}
+		log.Println("🎯 targeted functions:\n  " + strings.Join(targets, "\n  "))
+		userContent = "Generate unit tests targeting the coverage gaps of the following functions " +
+			"(exercise the uncovered lines, don't re-test what is already covered):\n- " +
+			strings.Join(targets, "\n- ") + "\n" +
+			"Source code:\n" + sourceCode
+	}
+
+	if g.WithImports {
+		var all []string
+		for _, src := range sources {
+			declarations, err := ImportsContext(src.path, g.ImportsMaxBytes)
+			if err != nil {
+				log.Println("⚠️ no imports context for", src.path+":", err)
+			} else if declarations != "" && !slices.Contains(all, declarations) {
+				all = append(all, declarations)
+			}
+		}
+		if len(all) > 0 {
+			userContent += "\n\nDeclarations of the packages imported from the same module " +
+				"(use them to reference the types correctly, do not test them):\n" + strings.Join(all, "\n")
+		}
+	}
+
+	if g.WithPackageContext {
+		var all []string
+		for _, src := range sources {
+			declarations, err := PackageContext(src.path, g.ExternalTest, g.PackageContextMaxBytes)
+			if err != nil {
+				log.Println("⚠️ no package context for", src.path+":", err)
+			} else if !slices.Contains(all, declarations) {
+				all = append(all, declarations)
+			}
+		}
+		if len(all) > 0 {
+			userContent += "\n\nDeclarations of the package under test, from all its files " +
+				"(the ground truth: use exactly these names and signatures, don't invent others):\n" + strings.Join(all, "\n")
+		}
+	}
+
+	// black-box tests of the exported API
+	var importPath string
+	if g.ExternalTest && g.Mode != "mocks" {
+		var err error
+		if importPath, err = ImportPath(sources[0].path); err != nil {
+			return Result{}, err
+		}
+		userContent += ExternalPrompt(packageName, importPath)
+	}
+
+	if g.Append && output != "" {
+		if existing, err := os.ReadFile(output); err == nil {
+			userContent += "\n\nThe following test file already exists. " +
+				"Generate only new test functions, do not repeat the existing ones " +
+				"and do not reuse their names:\n" + string(existing)
+		}
+	}
+
+	if len(g.Instructions) > 0 {
+		userContent += "\n\nAdditional instructions for these tests:\n- " + strings.Join(g.Instructions, "\n- ")
+	}
+
+	if g.PromptTemplate != nil && g.Mode != "mocks" {
+		var err error
+		userContent, err = RenderPrompt(g.PromptTemplate, PromptData{
+			Source:       sourceCode,
+			PackageName:  packageName,
+			Framework:    g.Framework,
+			Style:        g.Style,
+			FileName:     filesName,
+			Functions:    functions,
+			Instructions: g.Instructions,
+			Prompt:       userContent,
+		})
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	systemContent, err := SystemPrompt(g.Style, g.Framework)
+	if err != nil {
+		return Result{}, err
+	}
+
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(systemContent),
+		openai.UserMessage(userContent),
+	}
+
+	g.Debug.Text("system prompt", systemContent)
+	g.Debug.Text("user prompt", userContent)
+
+	param := openai.ChatCompletionNewParams{
+		Messages:    messages,
+		Model:       g.Model,
+		Temperature: openai.Opt(g.Temperature),
+	}
+	if g.Deterministic {
+		param.Temperature = openai.Opt(0.0)
+		param.Seed = openai.Int(g.Seed)
+	}
+
+	var requestHash string
+	if g.Sidecar && output != "" {
+		if requestHash, err = CacheKey(param); err != nil {
+			return Result{}, err
+		}
+		if !g.Force && g.upToDate(output, requestHash) {
+			log.Println("⏭️ unchanged since the last generation (-force to regenerate):", output)
+			return Result{Skipped: true}, nil
+		}
+	}
+
+	// keep stdout for the JSON document
+	var streamTo io.Writer
+	if g.Stream {
+		streamTo = os.Stdout
+		if g.OutputFormat == "json" {
+			streamTo = os.Stderr
+		}
+	}
+
+	completion, cached, err := g.complete(ctx, &param, streamTo)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{}
+	if cached {
+		log.Println("📦 served from cache (generated by", param.Model+")")
+	} else {
+		log.Println("🤖 generated by", param.Model)
+		result.Tokens = completion.Usage.TotalTokens
+	}
+	content := completion.Choices[0].Message.Content
+	g.Debug.Printf("usage: %d prompt tokens, %d completion tokens", completion.Usage.PromptTokens, completion.Usage.CompletionTokens)
+	g.Debug.Text("completion", content)
+	code := ExtractCode(content)
+
+	// the code is written to a file or a JSON document: no prose
+	if output != "" || g.OutputFormat == "json" {
+		code, err = CleanCode(code, packageName)
+		if err != nil {
+			return result, err
+		}
+		if code, err = DedupeImports(code); err != nil {
+			return result, err
+		}
+		if importPath != "" {
+			if code, err = ExternalPackage(code, packageName, importPath, TestFilePath(sources[0].path)); err != nil {
+				return result, err
+			}
+		}
+		if g.Mode == "examples" {
+			if err := CheckExamples(code); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if g.Mode == "mocks" {
+		code, err = FixPackage(code, packageName, MockFilePath(sources[0].path))
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	// the generated file compiles with the build constraints of the sources
+	if output != "" || g.OutputFormat == "json" {
+		expr, err := g.buildConstraint(sources)
+		if err != nil {
+			return result, err
+		}
+		code = WithBuildConstraint(code, expr)
+	}
+
+	if g.Intent != nil && g.Mode != "mocks" && (output != "" || g.OutputFormat == "json") {
+		if err := g.printIntent(sources, functions, removed, code); err != nil {
+			log.Println("⚠️ no tests summary:", err)
+		}
+	}
+
+	if output != "" {
+		written, err := g.writeFiles(output, code)
+		if err != nil {
+			return result, err
+		}
+		result.Skipped = !written
+		if written && g.Sidecar {
+			var contents [][]byte
+			for _, src := range sources {
+				contents = append(contents, src.content)
+			}
+			sidecar := Sidecar{
+				Model:       param.Model,
+				Temperature: param.Temperature.Value,
+				PromptHash:  Hash([]byte(systemContent), []byte(userContent)),
+				SourceHash:  Hash(contents...),
+				RequestHash: requestHash,
+				Timestamp:   time.Now().UTC(),
+			}
+			if g.Deterministic {
+				sidecar.Seed = &g.Seed
+			}
+			if err := WriteSidecar(output, sidecar); err != nil {
+				log.Println("⚠️ no sidecar:", err)
+			}
+		}
+	}
+
+	if g.OutputFormat == "json" {
+		return result, PrintJSON(os.Stdout, filePaths, packageName, code, param.Model, completion.Usage)
+	}
+
+	// already printed while streaming
+	if output == "" && (!g.Stream || cached) {
+		fmt.Println(content)
+	}
+	return result, nil
+}
+
+// printIntent reports which functions of the sources (the changed ones
+// with -changed) the generated tests reference
+func (g *Generator) printIntent(sources []source, changed []string, removed []string, code string) error {
+	var functions []string
+	for _, src := range sources {
+		declared, err := DeclaredFunctions(src.path, src.content)
+		if err != nil {
+			return err
+		}
+		for _, name := range declared {
+			if slices.Contains(removed, name) || (len(changed) > 0 && !slices.Contains(changed, name)) {
+				continue
+			}
+			// black-box tests only see the exported API
+			if g.ExternalTest && !exportedFunction(name) {
+				continue
+			}
+			functions = append(functions, name)
+		}
+	}
+	tested, err := TestedFunctions(code, functions)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, src := range sources {
+		files = append(files, src.path)
+	}
+	PrintIntent(g.Intent, strings.Join(files, ", "), functions, tested)
+	return nil
+}
+
+// buildConstraint returns the constraint of the -build-tags, or the
+// build constraints of the sources
+func (g *Generator) buildConstraint(sources []source) (constraint.Expr, error) {
+	if len(g.BuildTags) > 0 {
+		return TagsConstraint(g.BuildTags)
+	}
+	var contents [][]byte
+	for _, src := range sources {
+		contents = append(contents, src.content)
+	}
+	return BuildConstraints(contents)
+}
+
+// complete returns the completion of the cache, or runs it with the
+// fallback model if needed; param.Model is updated to the producing model
+func (g *Generator) complete(ctx context.Context, param *openai.ChatCompletionNewParams, streamTo io.Writer) (*openai.ChatCompletion, bool, error) {
+	key := ""
+	if g.Cache != nil {
+		var err error
+		if key, err = CacheKey(*param); err != nil {
+			return nil, false, err
+		}
+		if completion, ok := g.Cache.Get(key); ok && !g.Refresh {
+			param.Model = completion.Model
+			return completion, true, nil
+		}
+	}
+
+	completion, err := Complete(ctx, g.Client, *param, streamTo, g.Timeout)
+
+	if err != nil && g.FallbackModel != "" {
+		log.Println("🔁 model", g.Model, "failed:", err)
+		log.Println("🔁 falling back to", g.FallbackModel)
+		param.Model = g.FallbackModel
+		if g.Cache != nil {
+			if key, err = CacheKey(*param); err != nil {
+				return nil, false, err
+			}
+		}
+		completion, err = Complete(ctx, g.Client, *param, streamTo, g.Timeout)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if g.Cache != nil {
+		if err := g.Cache.Put(key, param.Model, completion); err != nil {
+			log.Println("⚠️ cache:", err)
+		}
+	}
+	return completion, false, nil
+}
+
+// upToDate tells if the output exists and its sidecar records the same request
+func (g *Generator) upToDate(output string, requestHash string) bool {
+	if _, err := os.Stat(output); err != nil {
+		return false
+	}
+	sidecar, err := ReadSidecar(output)
+	if err != nil {
+		log.Println("⚠️ sidecar:", err)
+		return false
+	}
+	return sidecar != nil && sidecar.RequestHash == requestHash
+}
+
+// writeFiles writes the generated code, split in several files over
+// -max-file-lines (not in append mode); it returns false when nothing was written
+func (g *Generator) writeFiles(output string, code string) (bool, error) {
+	if g.MaxFileLines <= 0 || g.Append {
+		return g.writeTests(output, code)
+	}
+	files, err := SplitCode(code, g.MaxFileLines)
+	if err != nil {
+		return false, err
+	}
+	if len(files) == 1 {
+		return g.writeTests(output, code)
+	}
+	var paths []string
+	for i, file := range files {
+		path := SplitPath(output, i+1)
+		written, err := g.writeTests(path, file)
+		if err != nil {
+			return len(paths) > 0, err
+		}
+		if written {
+			paths = append(paths, path)
+		}
+	}
+	log.Printf("✂️ split into %d files (-max-file-lines %d), %d written: %s", len(files), g.MaxFileLines, len(paths), strings.Join(paths, ", "))
+	// a previous split may have written more files, with the same test names
+	next := SplitPath(output, len(files)+1)
+	if _, err := os.Stat(next); err == nil {
+		log.Println("⚠️", next, "is left from a previous split, remove it")
+	}
+	return len(paths) > 0, nil
+}
+
+// writeTests writes (or merges in append mode) the generated code
+// into the test file, after approval in interactive mode; it returns
+// false when nothing was written
+func (g *Generator) writeTests(path string, code string) (bool, error) {
+	content, added, err := ProposeTests(path, code, g.Append)
+	if err != nil {
+		return false, err
+	}
+	if added != nil && len(added) == 0 {
+		log.Println("🙂 no new test function for", path)
+		return false, nil
+	}
+
+	if g.Approval != nil {
+		approved, ok, err := g.Approval.Review(path, content)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			log.Println("⏭️ skipped", path)
+			return false, nil
+		}
+		content = approved
+	}
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return false, err
+	}
+	if len(added) > 0 {
+		log.Println("➕ appended to", path+":", strings.Join(added, ", "))
+	} else {
+		log.Println("📝 written to", path)
+	}
+	return true, nil
+}
@@ -2,11 +2,18 @@ module generate
 
 go 1.24.0
 
-require github.com/openai/openai-go v0.1.0-beta.10
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/openai/openai-go v0.1.0-beta.10
+	golang.org/x/tools v0.38.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/tidwall/gjson v1.14.4 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
+	golang.org/x/mod v0.29.0 // indirect
+	golang.org/x/sync v0.17.0 // indirect
 )
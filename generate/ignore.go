@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ListFlag is a repeatable string flag
+type ListFlag []string
+
+func (l *ListFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *ListFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// IgnoreFile is the gitignore-style file listing the files to skip in directory mode
+const IgnoreFile = ".crackerignore"
+
+// ignorePattern is a line of a .crackerignore file
+type ignorePattern struct {
+	pattern  string
+	negate   bool
+	anchored bool
+}
+
+// Ignore matches file paths (relative to the processed directory)
+// against -skip-file globs and .crackerignore patterns
+type Ignore struct {
+	patterns []ignorePattern
+}
+
+// NewIgnore builds the matcher of the -skip-file globs
+func NewIgnore(globs []string) *Ignore {
+	ignore := &Ignore{}
+	for _, glob := range globs {
+		ignore.add(glob)
+	}
+	return ignore
+}
+
+// LoadIgnoreFile adds the patterns of the .crackerignore file of dir, if any
+func (i *Ignore) LoadIgnoreFile(dir string) error {
+	content, err := os.ReadFile(filepath.Join(dir, IgnoreFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		i.add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+func (i *Ignore) add(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	pattern := ignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	}
+	// "/foo.go" only matches at the root, "**/foo.go" anywhere
+	if strings.HasPrefix(line, "/") {
+		pattern.anchored = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "**/")
+	// a pattern with a slash is relative to the root
+	if strings.Contains(strings.TrimSuffix(line, "/"), "/") {
+		pattern.anchored = true
+	}
+	pattern.pattern = strings.TrimSuffix(line, "/")
+	i.patterns = append(i.patterns, pattern)
+}
+
+// Match returns true when the path is ignored; as with .gitignore,
+// the last matching pattern wins
+func (i *Ignore) Match(path string) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	ignored := false
+	for _, p := range i.patterns {
+		if p.matches(path) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (p ignorePattern) matches(path string) bool {
+	if p.anchored {
+		if ok, _ := filepath.Match(p.pattern, path); ok {
+			return true
+		}
+		// a directory pattern ignores everything below it
+		return strings.HasPrefix(path, p.pattern+"/")
+	}
+	// unanchored patterns match any path element
+	elements := strings.Split(path, "/")
+	for index, element := range elements {
+		if ok, _ := filepath.Match(p.pattern, element); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(p.pattern, strings.Join(elements[index:], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveFunctions returns the source without the declarations (and their
+// comments) of the skipped functions; names match "Func" or "Type.Method"
+func RemoveFunctions(filePath string, source []byte, skipped []string) (string, []string, error) {
+	if len(skipped) == 0 {
+		return string(source), nil, nil
+	}
+	skip := map[string]bool{}
+	for _, name := range skipped {
+		skip[name] = true
+	}
+
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, filePath, source, parser.ParseComments)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var removed []string
+	var removedRanges [][2]token.Pos
+	decls := parsed.Decls[:0]
+	for _, decl := range parsed.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && (skip[fn.Name.Name] || skip[funcName(fn)]) {
+			removed = append(removed, funcName(fn))
+			start := fn.Pos()
+			if fn.Doc != nil {
+				start = fn.Doc.Pos()
+			}
+			removedRanges = append(removedRanges, [2]token.Pos{start, fn.End()})
+			continue
+		}
+		decls = append(decls, decl)
+	}
+	parsed.Decls = decls
+
+	comments := parsed.Comments[:0]
+	for _, group := range parsed.Comments {
+		inRemoved := false
+		for _, r := range removedRanges {
+			if group.Pos() >= r[0] && group.End() <= r[1] {
+				inRemoved = true
+				break
+			}
+		}
+		if !inRemoved {
+			comments = append(comments, group)
+		}
+	}
+	parsed.Comments = comments
+
+	var out bytes.Buffer
+	if err := printer.Fprint(&out, fset, parsed); err != nil {
+		return "", nil, err
+	}
+	return out.String(), removed, nil
+}
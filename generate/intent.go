@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// DeclaredFunctions returns the functions ("Name") and methods ("Type.Name")
+// declared by a source file, without init and main
+func DeclaredFunctions(filePath string, source []byte) ([]string, error) {
+	parsed, err := parser.ParseFile(token.NewFileSet(), filePath, source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	var functions []string
+	for _, decl := range parsed.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || (fn.Recv == nil && (fn.Name.Name == "init" || fn.Name.Name == "main")) {
+			continue
+		}
+		functions = append(functions, funcName(fn))
+	}
+	return functions, nil
+}
+
+// TestedFunctions returns the functions referenced by the generated tests:
+// a function is referenced by its name, a method by a selector of its name
+func TestedFunctions(code string, functions []string) ([]string, error) {
+	parsed, err := parser.ParseFile(token.NewFileSet(), "", code, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	selectors := map[string]bool{}
+	ast.Inspect(parsed, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			selectors[n.Sel.Name] = true
+		case *ast.Ident:
+			names[n.Name] = true
+		}
+		return true
+	})
+	// the names of the test functions are not references
+	for _, decl := range parsed.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+			delete(names, fn.Name.Name)
+		}
+	}
+	var tested []string
+	for _, function := range functions {
+		if _, method, ok := strings.Cut(function, "."); ok {
+			if selectors[method] {
+				tested = append(tested, function)
+			}
+		} else if names[function] {
+			tested = append(tested, function)
+		}
+	}
+	return tested, nil
+}
+
+// PrintIntent prints which functions the generated tests reference
+func PrintIntent(out io.Writer, file string, functions []string, tested []string) {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "🧪 tests of %s:\n", file)
+	for _, function := range functions {
+		status := "✅ tested"
+		if !slices.Contains(tested, function) {
+			status = "❌ missed"
+		}
+		fmt.Fprintf(writer, "  %s\t%s\n", function, status)
+	}
+	fmt.Fprintf(writer, "  %d/%d functions referenced by the tests\n", len(tested), len(functions))
+	writer.Flush()
+}
@@ -2,52 +2,281 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go"
 )
 
-// MODEL_RUNNER_BASE_URL=http://localhost:12434 go run main.go
+// FlagOrEnv returns the flag value when set, the environment variable otherwise
+func FlagOrEnv(value string, name string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// MODEL_RUNNER_BASE_URL=http://localhost:12434 go run . main.go
 func main() {
-	// Docker Model Runner Chat base URL
-	llmURL := os.Getenv("MODEL_RUNNER_BASE_URL") + "/engines/llama.cpp/v1/"
-	model := os.Getenv("LLM")
+	profile := flag.String("profile", "", "named profile of the config file (model endpoint: model, base_url, provider, api_path, timeout), the flags and environment variables still win")
+	configFlag := flag.String("config", "", "config file (default: cracker.yaml, cracker.yml or cracker.toml searched upward from the working directory)")
+	changed := flag.Bool("changed", false, "only generate tests for the functions changed since the base ref (git diff)")
+	baseRef := flag.String("base", "HEAD", "git ref to diff against when using -changed")
+	output := flag.String("o", "", "write the generated code to this file instead of stdout (directories: <source>_test.go or <source>_mock.go)")
+	stream := flag.Bool("stream", false, "stream the completion to stdout as it arrives")
+	modelFlag := flag.String("model", "", "model to use (overrides LLM)")
+	baseURLFlag := flag.String("base-url", "", "base URL of the model runner (overrides MODEL_RUNNER_BASE_URL)")
+	fallbackModel := flag.String("fallback-model", "", "model to use when the primary model still fails after the retries")
+	retries := flag.Int("retries", 2, "number of retries (with backoff) of a failing completion request")
+	timeout := flag.Duration("timeout", 0, "timeout of a completion request, eg: 90s (0 = no timeout)")
+	provider := flag.String("provider", "dmr", "kind of OpenAI compatible endpoint: dmr (Docker Model Runner), ollama or openai")
+	apiPath := flag.String("api-path", "", "API path appended to the base URL (overrides the provider path, eg: /v1)")
+	apiKeyFlag := flag.String("api-key", "", "API key for endpoints requiring auth (overrides OPENAI_API_KEY)")
+	outputFormat := flag.String("output-format", "text", "output format: text or json (file, package, tests, usage and model)")
+	withImports := flag.Bool("with-imports", false, "add the declarations of the same-module imported packages to the prompt")
+	importsMaxBytes := flag.Int("imports-max-bytes", 16000, "maximum size of the imported declarations added with -with-imports")
+	withPackageContext := flag.Bool("with-package-context", false, "add the declarations of all the files of the package (types, funcs and methods signatures) to the prompt, the package must type-check")
+	packageContextMaxBytes := flag.Int("package-context-max-bytes", 16000, "maximum size of the package declarations added with -with-package-context")
+	style := flag.String("style", "", "test style: table (table-driven tests) or simple (one function per case)")
+	framework := flag.String("framework", "", "test framework: testing (standard library only) or testify")
+	temperature := flag.Float64("temperature", 0.8, "sampling temperature")
+	deterministic := flag.Bool("deterministic", false, "temperature 0 and a fixed seed (-seed) for reproducible output")
+	seed := flag.Int64("seed", 42, "seed sent with -deterministic (ignored by the backends without seed support)")
+	mode := flag.String("mode", "tests", "what to generate: tests (<source>_test.go), fuzz tests of the functions taking a []byte or a string (<source>_test.go), examples of the exported functions with // Output: comments (<source>_test.go) or mocks of the interfaces (<source>_mock.go)")
+	mockStyle := flag.String("mock-style", "handwritten", "style of the mocks with -mode mocks: handwritten, gomock or mockery")
+	var skipFunctions, skipFiles, buildTags, instructions ListFlag
+	flag.Var(&instructions, "instruction", "one-off instruction added to the prompt of this run, repeatable, eg: \"focus on the error paths\"")
+	flag.Var(&buildTags, "build-tags", "build tags of the generated file, comma separated or repeatable, instead of the build constraints of the source files")
+	flag.Var(&skipFunctions, "skip-func", "function (or Type.Method) to leave out of the prompt, repeatable")
+	flag.Var(&skipFiles, "skip-file", "glob of the files to skip, repeatable (directories also honor "+IgnoreFile+")")
+	promptTemplate := flag.String("prompt-template", "", "text/template file of the prompt, with {{.Source}}, {{.PackageName}}, {{.Framework}}, {{.FileName}}... ({{.Prompt}}: the built-in prompt)")
+	debug := flag.Bool("debug", false, "log the prompts and the completions, truncated to -debug-lines lines (the API key is never logged)")
+	debugFull := flag.Bool("debug-full", false, "like -debug, without truncation: the whole source code is logged")
+	debugLines := flag.Int("debug-lines", 20, "number of lines of the prompts and completions logged with -debug")
+	externalTest := flag.Bool("external-test", false, "black-box tests in the external <package>_test package, importing the package under test: only the exported API is tested")
+	maxFileLines := flag.Int("max-file-lines", 0, "split the generated tests over several files of at most this number of lines: <name>_test.go, <name>_2_test.go... (0 = no limit)")
+	sidecar := flag.Bool("sidecar", false, "write a <name>_test.cracker.json sidecar (model, hashes, temperature, timestamp) next to each generated file, and skip the files whose source and settings didn't change")
+	force := flag.Bool("force", false, "with -sidecar, regenerate the unchanged files; in directory mode, overwrite the existing test files")
+	quiet := flag.Bool("quiet", false, "no progress and no summary in directory mode")
+	noCache := flag.Bool("no-cache", false, "don't use the completions cache ($XDG_CACHE_HOME/cracker)")
+	refresh := flag.Bool("refresh", false, "ignore the cached completions and refresh them")
+	coverProfile := flag.String("coverprofile", "", "coverage profile (go test -coverprofile) to generate tests for the coverage gaps only")
+	coverageBelow := flag.Float64("coverage-below", 80, "with -coverprofile, target the functions with a statement coverage below this percentage")
+	interactive := flag.Bool("interactive", false, "show each proposed test file (or its diff) and ask before writing it")
+	appendMode := flag.Bool("append", false, "only generate new test functions and append them to the existing test file (-o, default: <source>_test.go)")
+	flag.Parse()
+
+	// the config file sets the flags not given on the command line
+	configPath := *configFlag
+	if configPath == "" {
+		var err error
+		if configPath, err = FindConfig("."); err != nil {
+			log.Fatalln("😡:", err)
+		}
+	}
+	if configPath != "" {
+		config, err := LoadConfig(configPath)
+		if err != nil {
+			log.Fatalln("😡:", err)
+		}
+		if *profile != "" {
+			if err := config.SelectProfile(*profile); err != nil {
+				log.Fatalln("😡:", configPath+":", err)
+			}
+			log.Println("👤 profile:", *profile)
+		}
+		if err := config.Apply(flag.CommandLine); err != nil {
+			log.Fatalln("😡:", err)
+		}
+		log.Println("⚙️ config:", configPath)
+	} else if *profile != "" {
+		log.Fatalln("😡: -profile", *profile, "without a config file")
+	}
+
+	// flags win over the environment variables
+	baseURL := FlagOrEnv(*baseURLFlag, "MODEL_RUNNER_BASE_URL")
+	model := FlagOrEnv(*modelFlag, "LLM")
+	apiKey := FlagOrEnv(*apiKeyFlag, "OPENAI_API_KEY")
+
+	if model == "" {
+		log.Fatalln("😡: no model, use the -model flag or the LLM environment variable")
+	}
+
+	// Docker Model Runner Chat base URL (by default)
+	llmURL, err := LLMURL(baseURL, *provider, *apiPath)
+	if err != nil {
+		log.Fatalln("😡:", err)
+	}
 
 	client := openai.NewClient(
 		option.WithBaseURL(llmURL),
-		option.WithAPIKey(""),
+		option.WithAPIKey(apiKey),
+		option.WithMaxRetries(*retries),
 	)
 
-	ctx := context.Background()
-
-	// content = first argument
-	filePath := os.Args[1:][0]
-	// sourceCode = content of filePath
-	file, err := os.ReadFile(filePath)
-	if err != nil {
+	if *outputFormat != "text" && *outputFormat != "json" {
+		log.Fatalln("😡: unknown output format", *outputFormat)
+	}
+	if _, err := SystemPrompt(*style, *framework); err != nil {
 		log.Fatalln("😡:", err)
 	}
-	sourceCode := string(file)
+	// generated file of a source file
+	outputPath := TestFilePath
+	switch *mode {
+	case "tests", "fuzz", "examples":
+	case "mocks":
+		outputPath = MockFilePath
+		if _, ok := mockStyles[*mockStyle]; !ok {
+			log.Fatalln("😡: unknown mock style", *mockStyle)
+		}
+	default:
+		log.Fatalln("😡: unknown mode", *mode)
+	}
+	// the existing tests are in the package itself
+	if *externalTest && *appendMode {
+		log.Fatalln("😡: -external-test can't append to an existing test file (-append)")
+	}
+
+	generator := &Generator{
+		Client:        client,
+		Model:         model,
+		FallbackModel: *fallbackModel,
+		Timeout:       *timeout,
+		Stream:        *stream,
+		OutputFormat:  *outputFormat,
+		Changed:       *changed,
+		BaseRef:       *baseRef,
+		Append:        *appendMode,
+		Style:         *style,
+		Framework:     *framework,
+		Temperature:   *temperature,
+		Mode:          *mode,
+		MockStyle:     *mockStyle,
+		SkipFunctions: skipFunctions,
+		BuildTags:     buildTags,
+		Instructions:  instructions,
+		CoverProfile:  *coverProfile,
+		CoverageBelow: *coverageBelow,
+		Deterministic: *deterministic,
+		Seed:          *seed,
 
-	messages := []openai.ChatCompletionMessageParamUnion{
-		openai.SystemMessage("You are a helpful assistant, expert in Golang Programming."),
-		openai.UserMessage("Generate unit tests for the following source code:\n" + sourceCode),
+		Sidecar:      *sidecar,
+		Force:        *force,
+		MaxFileLines: *maxFileLines,
+		ExternalTest: *externalTest,
+
+		WithImports:            *withImports,
+		ImportsMaxBytes:        *importsMaxBytes,
+		WithPackageContext:     *withPackageContext,
+		PackageContextMaxBytes: *packageContextMaxBytes,
+	}
+	if !*noCache {
+		cache, err := NewCache()
+		if err != nil {
+			log.Println("⚠️ no cache:", err)
+		} else {
+			generator.Cache = cache
+			generator.Refresh = *refresh
+		}
+	}
+	if !*quiet {
+		generator.Intent = os.Stderr
+	}
+	if *promptTemplate != "" {
+		tmpl, err := LoadPromptTemplate(*promptTemplate)
+		if err != nil {
+			log.Fatalln("😡:", err)
+		}
+		generator.PromptTemplate = tmpl
+	}
+	if *debug || *debugFull {
+		generator.Debug = &DebugLog{Lines: *debugLines, Full: *debugFull, Secrets: []string{apiKey}}
+		apiKeyState := "none"
+		if apiKey != "" {
+			apiKeyState = "set"
+		}
+		generator.Debug.Printf("endpoint: %s, model: %s, API key: %s", llmURL, model, apiKeyState)
+	}
+	if *interactive {
+		generator.Approval = NewApproval(os.Stdin, os.Stderr)
 	}
 
-	param := openai.ChatCompletionNewParams{
-		Messages: messages,
-		Model:    model,
-		Temperature: openai.Opt(0.8),
+	if len(instructions) > 0 {
+		log.Println("📌 instructions:\n  " + strings.Join(instructions, "\n  "))
 	}
 
-	completion, err := client.Chat.Completions.New(ctx, param)
+	ctx := context.Background()
 
+	// content = first argument(s)
+	if flag.NArg() < 1 {
+		log.Fatalln("😡: missing source file(s) or directory")
+	}
+	filePath := flag.Arg(0)
+
+	info, err := os.Stat(filePath)
 	if err != nil {
 		log.Fatalln("😡:", err)
 	}
-	fmt.Println(completion.Choices[0].Message.Content)
 
+	ignore := NewIgnore(skipFiles)
+
+	if flag.NArg() > 1 || !info.IsDir() {
+		// several files of a package: one consolidated test file
+		var files []string
+		for _, file := range flag.Args() {
+			if ignore.Match(file) || ignore.Match(filepath.Base(file)) {
+				log.Println("⏭️ skipped", file)
+				continue
+			}
+			files = append(files, file)
+		}
+		if len(files) == 0 {
+			return
+		}
+		if *output == "" && (*appendMode || *interactive) {
+			*output = outputPath(files[0])
+			if len(files) > 1 {
+				*output = outputPath(PackageFilePath(files[0]))
+			}
+		}
+		if _, err := generator.GenerateFiles(ctx, files, *output); err != nil {
+			log.Fatalln("😡:", err)
+		}
+		return
+	}
+
+	// directory mode: each source file gets its own test file
+	if *output != "" {
+		log.Fatalln("😡: -o can't be used with a directory")
+	}
+	files, err := SourceFiles(filePath)
+	if err != nil {
+		log.Fatalln("😡:", err)
+	}
+	if err := ignore.LoadIgnoreFile(filePath); err != nil {
+		log.Fatalln("😡:", err)
+	}
+	progress := NewProgress(os.Stderr, len(files), *quiet)
+	for _, file := range files {
+		if ignore.Match(filepath.Base(file)) {
+			progress.Skip(file)
+			continue
+		}
+		// never overwrite a hand-written test file without asking
+		if output := outputPath(file); !*force && !*appendMode && !*interactive && handWritten(output) {
+			log.Println("⏭️", output, "exists, skipped: -append to add the missing tests, -interactive to review, -force to overwrite")
+			progress.Skip(file)
+			continue
+		}
+		result, err := generator.GenerateFile(ctx, file, outputPath(file))
+		progress.Done(file, result, err)
+	}
+	progress.Summary()
+	if progress.Failed() > 0 {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/imports"
+)
+
+// instructions for each mock style (-mock-style)
+var mockStyles = map[string]string{
+	"handwritten": "Write hand-written mocks: for each interface, a `Mock<Name>` struct with " +
+		"a function field per method (eg: `GetFunc func(id string) (Item, error)`) " +
+		"called by the method, and recording the calls.",
+	"gomock": "Write gomock-style mocks (go.uber.org/mock/gomock), like the output of mockgen: " +
+		"a `Mock<Name>` struct with a controller and a recorder, `NewMock<Name>(ctrl)` " +
+		"and an `EXPECT()` method.",
+	"mockery": "Write mockery-style mocks (github.com/stretchr/testify/mock): " +
+		"a `<Name>` mock struct embedding `mock.Mock`, each method calling `m.Called(...)`, " +
+		"and a `New<Name>(t)` constructor asserting the expectations on cleanup.",
+}
+
+// Interfaces returns the package name and the names of the interfaces declared in the source
+func Interfaces(filePath string, source []byte) (string, []string, error) {
+	parsed, err := parser.ParseFile(token.NewFileSet(), filePath, source, parser.SkipObjectResolution)
+	if err != nil {
+		return "", nil, err
+	}
+	var names []string
+	ast.Inspect(parsed, func(node ast.Node) bool {
+		if spec, ok := node.(*ast.TypeSpec); ok {
+			if _, ok := spec.Type.(*ast.InterfaceType); ok {
+				names = append(names, spec.Name.Name)
+			}
+		}
+		return true
+	})
+	return parsed.Name.Name, names, nil
+}
+
+// MocksPrompt returns the user message asking for the mocks of the interfaces
+func MocksPrompt(packageName string, interfaces []string, mockStyle string, sourceCode string) (string, error) {
+	instructions, ok := mockStyles[mockStyle]
+	if !ok {
+		return "", fmt.Errorf("unknown mock style %q (handwritten, gomock or mockery)", mockStyle)
+	}
+	return "Generate mock implementations of the following interfaces: " +
+		strings.Join(interfaces, ", ") + ".\n" +
+		instructions + "\n" +
+		"The mocks belong to the package `" + packageName + "`. " +
+		"Only answer with the Go code of the mock file.\n" +
+		"Source code:\n" + sourceCode, nil
+}
+
+// MockFilePath returns the mock file path of a source file: foo.go => foo_mock.go
+func MockFilePath(filePath string) string {
+	return strings.TrimSuffix(filePath, ".go") + "_mock.go"
+}
+
+// FixPackage forces the package clause of the generated code
+// and deduplicates its imports with goimports
+func FixPackage(code string, packageName string, filename string) (string, error) {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, filename, code, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("generated code: %v", err)
+	}
+	parsed.Name.Name = packageName
+
+	var out bytes.Buffer
+	if err := printer.Fprint(&out, fset, parsed); err != nil {
+		return "", err
+	}
+	fixed, err := imports.Process(filename, out.Bytes(), nil)
+	if err != nil {
+		return "", err
+	}
+	return string(fixed), nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/imports"
+)
+
+// fenced code block of a markdown answer
+var codeFence = regexp.MustCompile("(?s)```(?:go|golang)?[ \t]*\n(.*?)```")
+
+// ExtractCode returns the Go code of the model answer:
+// the content of the fenced code blocks if any, the whole answer otherwise
+func ExtractCode(answer string) string {
+	blocks := codeFence.FindAllStringSubmatch(answer, -1)
+	if len(blocks) == 0 {
+		return strings.TrimSpace(answer) + "\n"
+	}
+	// keep the largest block (the model sometimes adds usage snippets)
+	code := ""
+	for _, block := range blocks {
+		if len(block[1]) > len(code) {
+			code = block[1]
+		}
+	}
+	return strings.TrimSpace(code) + "\n"
+}
+
+// declarations a fragment without package clause may start with
+var declStart = regexp.MustCompile(`^(import|func|type|var|const)\b`)
+
+// CleanCode makes sure the generated code is a valid Go file: when it doesn't
+// parse (eg: prose around the code), the largest parseable fragment is kept,
+// the package clause is added when the fragment has none
+func CleanCode(code string, packageName string) (string, error) {
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, "", code, parser.ParseComments); err == nil {
+		return code, nil
+	}
+
+	lines := strings.Split(code, "\n")
+	best := ""
+	try := func(prefix string, start int) {
+		// the fragment ends on a closing line: } or ) or an import path
+		for end := len(lines); end > start; end-- {
+			last := strings.TrimSpace(lines[end-1])
+			if !strings.HasSuffix(last, "}") && !strings.HasSuffix(last, ")") && !strings.HasSuffix(last, `"`) {
+				continue
+			}
+			fragment := prefix + strings.Join(lines[start:end], "\n") + "\n"
+			if len(fragment) <= len(best) {
+				return
+			}
+			if _, err := parser.ParseFile(fset, "", fragment, parser.ParseComments); err == nil {
+				best = fragment
+				return
+			}
+		}
+	}
+	for start, line := range lines {
+		if strings.HasPrefix(line, "package ") {
+			try("", start)
+		}
+	}
+	if best == "" && packageName != "" {
+		for start, line := range lines {
+			if declStart.MatchString(line) {
+				try("package "+packageName+"\n\n", start)
+			}
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("the generated code doesn't parse as Go code")
+	}
+	// a fragment may lack some imports
+	if fixed, err := imports.Process("fragment_test.go", []byte(best), nil); err == nil {
+		return string(fixed), nil
+	}
+	return best, nil
+}
+
+// PackageName returns the package name of a Go source file ("" if it doesn't parse)
+func PackageName(filePath string, source []byte) string {
+	parsed, err := parser.ParseFile(token.NewFileSet(), filePath, source, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+	return parsed.Name.Name
+}
+
+// PackageFilePath returns the file named after the package of a source file:
+// foo/bar.go (package baz) => foo/baz.go, for the files generated from several sources
+func PackageFilePath(filePath string) string {
+	name := "package"
+	if source, err := os.ReadFile(filePath); err == nil {
+		if packageName := PackageName(filePath, source); packageName != "" {
+			name = packageName
+		}
+	}
+	return filepath.Join(filepath.Dir(filePath), name+".go")
+}
+
+// DedupeImports removes the duplicated import specs (same name and path)
+// of the generated code, eg: when the tests of several files are combined
+func DedupeImports(code string) (string, error) {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, "", code, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	seen := map[string]bool{}
+	duplicated := false
+	for _, decl := range parsed.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		specs := gen.Specs[:0]
+		for _, spec := range gen.Specs {
+			importSpec := spec.(*ast.ImportSpec)
+			key := importSpec.Path.Value
+			if importSpec.Name != nil {
+				key = importSpec.Name.Name + " " + key
+			}
+			if seen[key] {
+				duplicated = true
+				continue
+			}
+			seen[key] = true
+			specs = append(specs, spec)
+		}
+		gen.Specs = specs
+	}
+	if !duplicated {
+		return code, nil
+	}
+	var out bytes.Buffer
+	if err := printer.Fprint(&out, fset, parsed); err != nil {
+		return "", err
+	}
+	// empty import declarations and blank lines are cleaned up by goimports
+	fixed, err := imports.Process("", out.Bytes(), nil)
+	if err != nil {
+		return out.String(), nil
+	}
+	return string(fixed), nil
+}
+
+// TestFilePath returns the default test file path of a source file: foo.go => foo_test.go
+func TestFilePath(filePath string) string {
+	return strings.TrimSuffix(filePath, ".go") + "_test.go"
+}
+
+// AppendTests merges the generated test code into the existing test file:
+// functions already declared in the existing file are dropped, the imports
+// are merged and the result is cleaned up with goimports
+func AppendTests(existing []byte, generated string, filename string) ([]byte, []string, error) {
+	fset := token.NewFileSet()
+	current, err := parser.ParseFile(fset, filename, existing, parser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("existing test file: %v", err)
+	}
+	genFset := token.NewFileSet()
+	addition, err := parser.ParseFile(genFset, "", generated, parser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generated code: %v", err)
+	}
+
+	declared := map[string]bool{}
+	for _, decl := range current.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			declared[funcName(fn)] = true
+		}
+	}
+
+	for _, spec := range addition.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		astutil.AddNamedImport(fset, current, name, path)
+	}
+
+	var out bytes.Buffer
+	if err := printer.Fprint(&out, fset, current); err != nil {
+		return nil, nil, err
+	}
+
+	var added []string
+	for _, decl := range addition.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			// keep the helpers types and variables of the model, but not its imports
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+				continue
+			}
+		} else if declared[funcName(fn)] {
+			continue
+		} else {
+			added = append(added, funcName(fn))
+		}
+		out.WriteString("\n")
+		if err := printer.Fprint(&out, genFset, &printer.CommentedNode{Node: decl, Comments: addition.Comments}); err != nil {
+			return nil, nil, err
+		}
+		out.WriteString("\n")
+	}
+
+	merged, err := imports.Process(filename, out.Bytes(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, added, nil
+}
+
+// JSONOutput is the document printed with -output-format json
+type JSONOutput struct {
+	File string `json:"file"`
+	// all the files when several files were combined
+	Files   []string  `json:"files,omitempty"`
+	Package string    `json:"package"`
+	Tests   string    `json:"tests"`
+	Usage   JSONUsage `json:"usage"`
+	Model   string    `json:"model"`
+}
+
+type JSONUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// PrintJSON writes the generated tests and their metadata as a JSON document
+func PrintJSON(w io.Writer, filePaths []string, packageName string, tests string, model string, usage openai.CompletionUsage) error {
+	var files []string
+	if len(filePaths) > 1 {
+		files = filePaths
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(JSONOutput{
+		File:    filePaths[0],
+		Files:   files,
+		Package: packageName,
+		Tests:   tests,
+		Usage: JSONUsage{
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+		},
+		Model: model,
+	})
+}
+
+// ProposeTests returns the content of the test file to write: the generated code,
+// or in append mode the existing file merged with the new test functions
+// (added lists them, it is nil when nothing was merged)
+func ProposeTests(path string, code string, appendMode bool) ([]byte, []string, error) {
+	existing, err := os.ReadFile(path)
+	if appendMode && err == nil {
+		merged, added, err := AppendTests(existing, code, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if added == nil {
+			added = []string{}
+		}
+		return merged, added, nil
+	}
+	return []byte(code), nil, nil
+}
+
+// SourceFiles returns the Go source files (tests and generated mocks excluded) of a directory
+func SourceFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || strings.HasSuffix(name, "_mock.go") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// PackageContext returns the declarations (consts, vars, types, funcs and
+// methods, without the bodies) of the package of the source file, from all
+// its files: the ground truth of the signatures. The package must
+// type-check. With exportedOnly, only the exported API (black-box tests).
+func PackageContext(filePath string, exportedOnly bool, maxBytes int) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedModule,
+		Dir:  filepath.Dir(absPath),
+	}
+	pkgs, err := packages.Load(cfg, "file="+absPath)
+	if err != nil {
+		return "", err
+	}
+	if len(pkgs) == 0 || pkgs[0].Module == nil {
+		return "", fmt.Errorf("%s is not part of a Go module", filePath)
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		var errs []error
+		for _, pkgErr := range pkg.Errors {
+			errs = append(errs, pkgErr)
+		}
+		return "", fmt.Errorf("the package doesn't type-check: %w", errors.Join(errs...))
+	}
+
+	mode := doc.AllDecls
+	if exportedOnly {
+		mode = 0
+	}
+	docPkg, err := doc.NewFromFiles(pkg.Fset, pkg.Syntax, pkg.PkgPath, mode)
+	if err != nil {
+		return "", err
+	}
+
+	var context strings.Builder
+	fmt.Fprintf(&context, "// package %s (%q)\n", pkg.Name, pkg.PkgPath)
+	write := func(node ast.Node) error {
+		text, err := printNode(pkg.Fset, declaration(node))
+		if err != nil {
+			return err
+		}
+		context.WriteString(text + "\n")
+		return nil
+	}
+	var nodes []ast.Node
+	for _, value := range append(docPkg.Consts, docPkg.Vars...) {
+		nodes = append(nodes, value.Decl)
+	}
+	for _, typ := range docPkg.Types {
+		nodes = append(nodes, typ.Decl)
+		for _, value := range append(typ.Consts, typ.Vars...) {
+			nodes = append(nodes, value.Decl)
+		}
+		for _, fn := range append(typ.Funcs, typ.Methods...) {
+			nodes = append(nodes, fn.Decl)
+		}
+	}
+	for _, fn := range docPkg.Funcs {
+		nodes = append(nodes, fn.Decl)
+	}
+	for _, node := range nodes {
+		if err := write(node); err != nil {
+			return "", err
+		}
+	}
+
+	text := context.String()
+	if maxBytes > 0 && len(text) > maxBytes {
+		text = text[:maxBytes] + "\n// ... (truncated)\n"
+	}
+	return text, nil
+}
+
+// declaration returns a copy of the declaration without doc comments and
+// function body
+func declaration(node ast.Node) ast.Node {
+	switch decl := node.(type) {
+	case *ast.FuncDecl:
+		signature := *decl
+		signature.Doc, signature.Body = nil, nil
+		return &signature
+	case *ast.GenDecl:
+		spec := *decl
+		spec.Doc = nil
+		return &spec
+	}
+	return node
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Progress reports the processing of the files of a directory run
+// (`[3/20] foo.go ... ok`) and prints the final summary
+type Progress struct {
+	out   io.Writer
+	quiet bool
+	total int
+	done  int
+	start time.Time
+
+	generated, skipped, failed int
+	tokens                     int64
+}
+
+func NewProgress(out io.Writer, total int, quiet bool) *Progress {
+	return &Progress{out: out, quiet: quiet, total: total, start: time.Now()}
+}
+
+// Skip records a file skipped before generation (ignored file)
+func (p *Progress) Skip(file string) {
+	p.Done(file, Result{Skipped: true}, nil)
+}
+
+// Done records the result of a file
+func (p *Progress) Done(file string, result Result, err error) {
+	p.done++
+	p.tokens += result.Tokens
+	status := "ok"
+	switch {
+	case err != nil:
+		p.failed++
+		status = "failed: " + err.Error()
+	case result.Skipped:
+		p.skipped++
+		status = "skipped"
+	default:
+		p.generated++
+	}
+	if !p.quiet {
+		fmt.Fprintf(p.out, "[%d/%d] %s ... %s\n", p.done, p.total, file, status)
+	}
+}
+
+// Summary prints the counts, the total tokens and the elapsed time
+func (p *Progress) Summary() {
+	if p.quiet {
+		return
+	}
+	fmt.Fprintf(p.out, "📊 %d generated, %d skipped, %d failed, %d tokens, %s\n",
+		p.generated, p.skipped, p.failed, p.tokens, time.Since(p.start).Round(time.Millisecond))
+}
+
+// Failed returns the number of failed files
+func (p *Progress) Failed() int {
+	return p.failed
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// instructions added to the system prompt for each test style
+var styleInstructions = map[string]string{
+	"table": "Write table-driven tests: for each function, declare the cases in a " +
+		"`tests := []struct{...}` slice (with a `name` field) and run them in a " +
+		"`for _, tt := range tests` loop with `t.Run(tt.name, ...)`.",
+	"simple": "Write one test function per case (eg: TestAdd_PositiveNumbers), " +
+		"without table-driven tests.",
+}
+
+// instructions added to the system prompt for each test framework
+var frameworkInstructions = map[string]string{
+	"testing": "Only use the standard library `testing` package, no assertion library.",
+	"testify": "Use testify for the assertions: `github.com/stretchr/testify/assert` " +
+		"and `github.com/stretchr/testify/require`.",
+}
+
+// SystemPrompt returns the system message for the given test style and
+// framework ("" for no preference)
+func SystemPrompt(style string, framework string) (string, error) {
+	prompt := "You are a helpful assistant, expert in Golang Programming."
+	if style != "" {
+		instructions, ok := styleInstructions[style]
+		if !ok {
+			return "", fmt.Errorf("unknown test style %q (table or simple)", style)
+		}
+		prompt += "\n" + instructions
+	}
+	if framework != "" {
+		instructions, ok := frameworkInstructions[framework]
+		if !ok {
+			return "", fmt.Errorf("unknown test framework %q (testing or testify)", framework)
+		}
+		prompt += "\n" + instructions
+	}
+	return prompt, nil
+}
+
+// PromptData are the placeholders of a prompt template (-prompt-template)
+type PromptData struct {
+	// code of the source files (with a marker before each file when several)
+	Source      string
+	PackageName string
+	Framework   string
+	Style       string
+	// source files, comma separated
+	FileName string
+	// changed functions with -changed
+	Functions    []string
+	Instructions []string
+	// the built-in prompt, to wrap it
+	Prompt string
+}
+
+// LoadPromptTemplate parses a text/template prompt file, which must use
+// {{.Source}} or {{.Prompt}}
+func LoadPromptTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	fields := templateFields(tmpl.Tree.Root)
+	if !fields["Source"] && !fields["Prompt"] {
+		return nil, fmt.Errorf("%s: the prompt template must use {{.Source}} or {{.Prompt}}", path)
+	}
+	for field := range fields {
+		if !slices.Contains(promptFields, field) {
+			return nil, fmt.Errorf("%s: unknown placeholder {{.%s}} (%s)", path, field, strings.Join(promptFields, ", "))
+		}
+	}
+	return tmpl, nil
+}
+
+// placeholders of the prompt templates
+var promptFields = []string{"Source", "PackageName", "Framework", "Style", "FileName", "Functions", "Instructions", "Prompt"}
+
+// RenderPrompt returns the user message of the prompt template
+func RenderPrompt(tmpl *template.Template, data PromptData) (string, error) {
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", err
+	}
+	return prompt.String(), nil
+}
+
+// templateFields returns the fields of the dot used by the template ({{.Name}})
+func templateFields(node parse.Node) map[string]bool {
+	fields := map[string]bool{}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, command := range n.Cmds {
+				for _, arg := range command.Args {
+					walk(arg)
+				}
+			}
+		case *parse.FieldNode:
+			fields[n.Ident[0]] = true
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	walk(node)
+	return fields
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpenAI compatible API path of each supported provider
+var providerPaths = map[string]string{
+	"dmr":    "/engines/llama.cpp/v1/", // Docker Model Runner
+	"ollama": "/v1/",
+	"openai": "/v1/",
+}
+
+// default base URL of the hosted providers
+var providerBaseURLs = map[string]string{
+	"openai": "https://api.openai.com",
+}
+
+// LLMURL builds the chat base URL from the runner base URL and the provider,
+// apiPath (when not empty) replaces the provider path
+func LLMURL(baseURL string, provider string, apiPath string) (string, error) {
+	path, ok := providerPaths[provider]
+	if !ok {
+		return "", fmt.Errorf("unknown provider %q (dmr, ollama or openai)", provider)
+	}
+	if apiPath != "" {
+		path = "/" + strings.Trim(apiPath, "/") + "/"
+	}
+	if baseURL == "" {
+		baseURL = providerBaseURLs[provider]
+	}
+	return strings.TrimSuffix(baseURL, "/") + path, nil
+}
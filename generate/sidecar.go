@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sidecar records how a test file was generated (-sidecar), next to it:
+// <name>_test.cracker.json
+type Sidecar struct {
+	Model       string  `json:"model"`
+	Temperature float64 `json:"temperature"`
+	Seed        *int64  `json:"seed,omitempty"`
+	// sha256 of the system and user prompts
+	PromptHash string `json:"promptHash"`
+	// sha256 of the source files
+	SourceHash string `json:"sourceHash"`
+	// sha256 of the request (CacheKey): source and settings, an unchanged
+	// hash skips the file
+	RequestHash string    `json:"requestHash"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// SidecarPath returns the sidecar of a generated file
+func SidecarPath(output string) string {
+	return strings.TrimSuffix(output, ".go") + ".cracker.json"
+}
+
+// handWritten tells if the test file exists and was not generated with a
+// sidecar (-sidecar)
+func handWritten(output string) bool {
+	if _, err := os.Stat(output); err != nil {
+		return false
+	}
+	_, err := os.Stat(SidecarPath(output))
+	return err != nil
+}
+
+// ReadSidecar reads the sidecar of a generated file, nil when there is none
+func ReadSidecar(output string) (*Sidecar, error) {
+	data, err := os.ReadFile(SidecarPath(output))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sidecar := &Sidecar{}
+	if err := json.Unmarshal(data, sidecar); err != nil {
+		return nil, err
+	}
+	return sidecar, nil
+}
+
+// WriteSidecar writes the sidecar of a generated file
+func WriteSidecar(output string, sidecar Sidecar) error {
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(SidecarPath(output), append(data, '\n'), 0644)
+}
+
+// Hash returns the sha256 of the texts
+func Hash(texts ...[]byte) string {
+	hash := sha256.New()
+	for _, text := range texts {
+		hash.Write(text)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/imports"
+)
+
+// SplitCode splits the generated code in files of about maxLines lines
+// (-max-file-lines): the test, fuzz, benchmark and example functions are
+// spread over the files, the first one keeps the helpers (types, variables,
+// other functions), which the files of the package share. Each file has
+// the header (build constraint) and the package clause, and only the
+// imports it uses. A single test function longer than maxLines isn't split.
+func SplitCode(code string, maxLines int) ([]string, error) {
+	if maxLines <= 0 || strings.Count(code, "\n") <= maxLines {
+		return []string{code}, nil
+	}
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, "", code, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+
+	// header, package clause and imports, repeated in each file
+	head := code[:offset(parsed.Name.End())] + "\n"
+	var importDecls []string
+	var helpers, tests []string
+	for _, decl := range parsed.Decls {
+		start, end := decl.Pos(), decl.End()
+		var isTest bool
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			if d.Tok == token.IMPORT {
+				importDecls = append(importDecls, code[offset(start):offset(end)])
+				continue
+			}
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			isTest = d.Recv == nil && testFunction(d.Name.Name)
+		}
+		text := code[offset(start):offset(end)]
+		if isTest {
+			tests = append(tests, text)
+		} else {
+			helpers = append(helpers, text)
+		}
+	}
+	head += "\n" + strings.Join(importDecls, "\n") + "\n"
+
+	var files []string
+	var current []string
+	lines := strings.Count(head, "\n")
+	for _, helper := range helpers {
+		current = append(current, helper)
+		lines += strings.Count(helper, "\n") + 2
+	}
+	for _, test := range tests {
+		size := strings.Count(test, "\n") + 2
+		if lines+size > maxLines && len(current) > 0 {
+			files = append(files, head+"\n"+strings.Join(current, "\n\n")+"\n")
+			current, lines = nil, strings.Count(head, "\n")
+		}
+		current = append(current, test)
+		lines += size
+	}
+	if len(current) > 0 {
+		files = append(files, head+"\n"+strings.Join(current, "\n\n")+"\n")
+	}
+
+	// drop the unused imports of each file
+	for i, file := range files {
+		processed, err := imports.Process("", []byte(file), nil)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = string(processed)
+	}
+	return files, nil
+}
+
+// testFunction tells if the function is run by go test
+func testFunction(name string) bool {
+	for _, prefix := range []string{"Test", "Fuzz", "Benchmark", "Example"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitPath returns the path of the nth file of a split output:
+// foo_test.go => foo_2_test.go, foo_mock.go => foo_mock_2.go
+func SplitPath(output string, n int) string {
+	if n == 1 {
+		return output
+	}
+	if base, ok := strings.CutSuffix(output, "_test.go"); ok {
+		return fmt.Sprintf("%s_%d_test.go", base, n)
+	}
+	return fmt.Sprintf("%s_%d.go", strings.TrimSuffix(output, ".go"), n)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/extism/go-pdk"
+)
+
+// emit is provided by the cracker runner (-stream-ndjson): it sends a
+// record to the client of POST /stream/{name}, and returns 1 when the
+// client is gone (the plugin stops)
+//
+//go:wasmimport extism:host/user emit
+func emit(record uint64) uint64
+
+//export count_to
+func count_to() {
+	n, err := strconv.Atoi(string(pdk.Input()))
+	if err != nil {
+		pdk.SetErrorString("the input is not a number")
+		return
+	}
+
+	// one record at a time, nothing is buffered
+	for i := 1; i <= n; i++ {
+		mem := pdk.AllocateString(`{"n":` + strconv.Itoa(i) + `}`)
+		stop := emit(mem.Offset())
+		mem.Free()
+		if stop != 0 {
+			return
+		}
+	}
+}
+
+func main() {
+	//count_to()
+}
@@ -0,0 +1,6 @@
+#!/bin/bash
+tinygo build -scheduler=none --no-debug \
+  -o plugin.wasm \
+  -target wasi main.go
+
+ls -lh *.wasm
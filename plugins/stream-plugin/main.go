@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/extism/go-pdk"
+)
+
+// read_chunk is provided by the cracker runner (-stream-body):
+// it returns the offset of the next chunk of the request body
+// (at most max bytes), or 0 at the end of the body
+//
+//go:wasmimport extism:host/user read_chunk
+func readChunk(max uint64) uint64
+
+//export count_lines
+func count_lines() {
+
+	// pull the body chunk by chunk, without holding it all
+	size, lines := 0, 0
+	for {
+		offset := readChunk(64 * 1024)
+		if offset == 0 {
+			break
+		}
+		mem := pdk.FindMemory(offset)
+		chunk := mem.ReadBytes()
+		mem.Free()
+
+		size += len(chunk)
+		for _, b := range chunk {
+			if b == '\n' {
+				lines++
+			}
+		}
+	}
+
+	pdk.OutputString(strconv.Itoa(size) + " bytes, " + strconv.Itoa(lines) + " lines")
+}
+
+func main() {
+	//count_lines()
+}